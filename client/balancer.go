@@ -0,0 +1,259 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/katassh"
+	"github.com/kinfkong/ikatago-client/tracing"
+)
+
+const (
+	// StrategyFastest routes the sessions to the account with the lowest query-server latency
+	StrategyFastest = "fastest"
+	// StrategyLeastLoaded routes the sessions to the account with the lowest load reported by query-server,
+	// the queue first and then the usage
+	StrategyLeastLoaded = "least-loaded"
+)
+
+// CandidateStatus represents the status of an account in the balancer
+type CandidateStatus struct {
+	Name           string `json:"name"`
+	Platform       string `json:"platform"`
+	Username       string `json:"username"`
+	Available      bool   `json:"available"`
+	LatencyMillis  int64  `json:"latencyMillis"`
+	ActiveSessions int    `json:"activeSessions"`
+	Queue          *int   `json:"queue,omitempty"`
+	Usage          string `json:"usage,omitempty"`
+	LastError      string `json:"lastError,omitempty"`
+}
+
+type candidate struct {
+	client *Client
+	status CandidateStatus
+}
+
+// Balancer routes the katago sessions to several accounts on several platforms, and fails over to the next one
+// if the connection or the startup fails. the failover only covers the failures before katago is started,
+// the session is not moved to another account if it fails after EventEngineStarted.
+type Balancer struct {
+	strategy   string
+	tracer     *tracing.Tracer
+	lock       sync.Mutex
+	candidates []*candidate
+}
+
+// NewBalancer creates the balancer, names are used in the logs and the statuses
+func NewBalancer(strategy string, names []string, options []Options) (*Balancer, error) {
+	if strategy != StrategyFastest && strategy != StrategyLeastLoaded {
+		return nil, errors.New("invalid_strategy")
+	}
+	if len(options) == 0 || len(names) != len(options) {
+		return nil, errors.New("no_candidates")
+	}
+	balancer := &Balancer{
+		strategy:   strategy,
+		candidates: make([]*candidate, 0, len(options)),
+	}
+	for i := range options {
+		client, err := NewClient(options[i])
+		if err != nil {
+			return nil, err
+		}
+		balancer.candidates = append(balancer.candidates, &candidate{
+			client: client,
+			status: CandidateStatus{
+				Name:      names[i],
+				Platform:  options[i].Platform,
+				Username:  options[i].Username,
+				Available: true,
+			},
+		})
+	}
+	return balancer, nil
+}
+
+// SetTracer sets the tracer which records the check and the accounts tried by RunKatago
+func (balancer *Balancer) SetTracer(tracer *tracing.Tracer) {
+	balancer.tracer = tracer
+}
+
+// Check checks all the accounts with query-server at the same time, the latency and the load of the servers are updated
+func (balancer *Balancer) Check() []CandidateStatus {
+	span := balancer.tracer.StartSpan("check-accounts")
+	defer span.End(nil)
+	var wg sync.WaitGroup
+	for _, c := range balancer.candidates {
+		wg.Add(1)
+		go func(c *candidate) {
+			defer wg.Done()
+			start := time.Now()
+			info, err := c.client.QueryServerInfo()
+			latency := time.Since(start)
+			balancer.lock.Lock()
+			defer balancer.lock.Unlock()
+			c.status.Available = err == nil
+			c.status.LatencyMillis = latency.Milliseconds()
+			c.status.Queue = nil
+			c.status.Usage = ""
+			c.status.LastError = ""
+			if info != nil {
+				c.status.Queue = info.Queue
+				c.status.Usage = info.Usage
+			}
+			if err != nil {
+				log.Printf("ERROR account %s is not available: %v\n", c.status.Name, err)
+				c.status.LastError = err.Error()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return balancer.Statuses()
+}
+
+// Statuses returns the statuses of all the accounts
+func (balancer *Balancer) Statuses() []CandidateStatus {
+	balancer.lock.Lock()
+	defer balancer.lock.Unlock()
+	statuses := make([]CandidateStatus, 0, len(balancer.candidates))
+	for _, c := range balancer.candidates {
+		statuses = append(statuses, c.status)
+	}
+	return statuses
+}
+
+// RunKatago runs katago on the best account, and tries the next one if it cannot be started.
+// the name of the chosen account is returned with the session.
+func (balancer *Balancer) RunKatago(options RunKatagoOptions, subCommands []string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, onReady func()) (*SessionResult, string, error) {
+	var lastErr error = errors.New("no_available_candidates")
+	for _, c := range balancer.ordered() {
+		span := balancer.tracer.StartSpan("try-account")
+		span.SetAttribute("account", c.status.Name)
+		result, err := balancer.runOn(c, options, subCommands, inputReader, outputWriter, stderrWriter, onReady)
+		span.End(err)
+		if err == nil {
+			// the trace of the startup ends when katago is started, it is exported by the caller
+			balancer.tracer.End(nil)
+			return result, c.status.Name, nil
+		}
+		if errors.Is(err, katassh.ErrStopped) {
+			// stopped by the user, not a failure of the account
+			return nil, "", err
+		}
+		log.Printf("ERROR failed to start katago on %s, try the next one: %v\n", c.status.Name, err)
+		lastErr = err
+	}
+	return nil, "", lastErr
+}
+
+// runOn runs katago on the account, and waits until the engine is started or failed
+func (balancer *Balancer) runOn(c *candidate, options RunKatagoOptions, subCommands []string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, onReady func()) (*SessionResult, error) {
+	startupResult := make(chan error, 1)
+	onEvent := options.OnEvent
+	options.OnEvent = func(event Event) {
+		if event.Type == EventEngineStarted {
+			startupResult <- nil
+		} else if event.Type == EventFailed {
+			startupResult <- event.Err
+		}
+		if onEvent != nil {
+			onEvent(event)
+		}
+	}
+	result, err := c.client.RunKatago(options, subCommands, inputReader, outputWriter, stderrWriter, onReady)
+	if err == nil {
+		err = <-startupResult
+	}
+	balancer.lock.Lock()
+	defer balancer.lock.Unlock()
+	if errors.Is(err, katassh.ErrStopped) {
+		return nil, err
+	}
+	if err != nil {
+		c.status.Available = false
+		c.status.LastError = err.Error()
+		return nil, err
+	}
+	c.status.ActiveSessions++
+	go func() {
+		<-result.Done()
+		balancer.lock.Lock()
+		defer balancer.lock.Unlock()
+		c.status.ActiveSessions--
+	}()
+	return result, nil
+}
+
+// ordered returns the candidates in the order to try: the available ones first, then by the strategy
+func (balancer *Balancer) ordered() []*candidate {
+	balancer.lock.Lock()
+	defer balancer.lock.Unlock()
+	candidates := make([]*candidate, len(balancer.candidates))
+	copy(candidates, balancer.candidates)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a := candidates[i].status
+		b := candidates[j].status
+		if a.Available != b.Available {
+			return a.Available
+		}
+		if balancer.strategy == StrategyLeastLoaded {
+			loadA, okA := a.load()
+			loadB, okB := b.load()
+			if okA != okB {
+				// the servers which do not report the load are tried last
+				return okA
+			}
+			if loadA != loadB {
+				return loadA < loadB
+			}
+		}
+		return a.LatencyMillis < b.LatencyMillis
+	})
+	return candidates
+}
+
+// load returns the load of the server reported by query-server, false if the server does not report it.
+// every queued session counts more than the usage, which is at most 1.
+func (status CandidateStatus) load() (float64, bool) {
+	usage, usageOK := parseUsage(status.Usage)
+	if status.Queue == nil && !usageOK {
+		return 0, false
+	}
+	load := usage
+	if status.Queue != nil {
+		load += float64(*status.Queue)
+	}
+	return load, true
+}
+
+// parseUsage parses the usage of query-server, like "1/4" or "25%", to the ratio
+func parseUsage(usage string) (float64, bool) {
+	usage = strings.TrimSpace(usage)
+	if strings.HasSuffix(usage, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(usage, "%")), 64)
+		if err != nil {
+			return 0, false
+		}
+		return percent / 100, true
+	}
+	parts := strings.Split(usage, "/")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	used, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, false
+	}
+	total, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || total <= 0 {
+		return 0, false
+	}
+	return used / total, true
+}
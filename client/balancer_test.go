@@ -0,0 +1,55 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestBalancerOrderedLeastLoaded(t *testing.T) {
+	queue := func(n int) *int {
+		return &n
+	}
+	balancer := &Balancer{
+		strategy: StrategyLeastLoaded,
+		candidates: []*candidate{
+			{status: CandidateStatus{Name: "unknown", Available: true, LatencyMillis: 10}},
+			{status: CandidateStatus{Name: "queued", Available: true, LatencyMillis: 20, Queue: queue(1), Usage: "0/4"}},
+			{status: CandidateStatus{Name: "busy", Available: true, LatencyMillis: 30, Queue: queue(0), Usage: "3/4"}},
+			{status: CandidateStatus{Name: "idle", Available: true, LatencyMillis: 40, Usage: "25%"}},
+			{status: CandidateStatus{Name: "down", Available: false, LatencyMillis: 1, Queue: queue(0)}},
+		},
+	}
+	want := []string{"idle", "busy", "queued", "unknown", "down"}
+	for i, c := range balancer.ordered() {
+		if c.status.Name != want[i] {
+			t.Errorf("candidate %d: got %s, want %s", i, c.status.Name, want[i])
+		}
+	}
+	balancer.strategy = StrategyFastest
+	want = []string{"unknown", "queued", "busy", "idle", "down"}
+	for i, c := range balancer.ordered() {
+		if c.status.Name != want[i] {
+			t.Errorf("fastest candidate %d: got %s, want %s", i, c.status.Name, want[i])
+		}
+	}
+}
+
+func TestParseUsage(t *testing.T) {
+	tests := []struct {
+		usage string
+		ratio float64
+		ok    bool
+	}{
+		{"1/4", 0.25, true},
+		{" 2 / 2 ", 1, true},
+		{"50%", 0.5, true},
+		{"1/0", 0, false},
+		{"busy", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		ratio, ok := parseUsage(test.usage)
+		if ratio != test.ratio || ok != test.ok {
+			t.Errorf("parseUsage(%q): got %v %v, want %v %v", test.usage, ratio, ok, test.ratio, test.ok)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	benchmarkResultPattern = regexp.MustCompile(`numSearchThreads\s*=\s*(\d+):.*visits/s\s*=\s*([\d.]+)`)
+	benchmarkEvalsPattern  = regexp.MustCompile(`nnEvals/s\s*=\s*([\d.]+)`)
+	benchmarkBatchPattern  = regexp.MustCompile(`(?:avg batch size|avgBatchSize)\s*=\s*([\d.]+)`)
+	benchmarkEloPattern    = regexp.MustCompile(`EloDiff\s+([+-]?[\d.]+)`)
+	benchmarkRecommended   = regexp.MustCompile(`numSearchThreads\s*=\s*(\d+):.*\(recommended\)`)
+)
+
+// BenchmarkResult represents the speed of a thread count in the katago benchmark
+type BenchmarkResult struct {
+	Threads          int      `json:"threads"`
+	VisitsPerSecond  float64  `json:"visitsPerSecond"`
+	NNEvalsPerSecond float64  `json:"nnEvalsPerSecond"`
+	AvgBatchSize     float64  `json:"avgBatchSize"`
+	EloDiff          *float64 `json:"eloDiff,omitempty"`
+}
+
+// BenchmarkReport represents the parsed output of the katago benchmark
+type BenchmarkReport struct {
+	Results            []BenchmarkResult `json:"results"`
+	RecommendedThreads int               `json:"recommendedThreads"`
+	Raw                string            `json:"raw"`
+}
+
+// Benchmark runs the katago benchmark on the server with the weight of the options, and parses the result.
+// the katago logs are written to stderrWriter as the progress.
+func (client *Client) Benchmark(options RunKatagoOptions, subCommands []string, stderrWriter io.Writer) (*BenchmarkReport, error) {
+	if len(subCommands) == 0 || subCommands[0] != "benchmark" {
+		subCommands = append([]string{"benchmark"}, subCommands...)
+	}
+	options.UseRawData = false
+	options.FallbackKatago = nil
+	inputReader, inputWriter := io.Pipe()
+	defer inputWriter.Close()
+	output := &lockedBuffer{}
+	result, err := client.RunKatago(options, subCommands, inputReader, output, io.MultiWriter(output, stderrWriter), nil)
+	if err != nil {
+		return nil, err
+	}
+	result.Wait()
+	report := ParseBenchmark(output.String())
+	if len(report.Results) == 0 {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return nil, errors.New("no_benchmark_results")
+	}
+	return report, nil
+}
+
+// ParseBenchmark parses the output of the katago benchmark. the thread count marked as recommended is
+// recommended, otherwise the one with the highest elo, otherwise the fastest one.
+func ParseBenchmark(output string) *BenchmarkReport {
+	report := &BenchmarkReport{Results: make([]BenchmarkResult, 0), Raw: output}
+	indexes := make(map[int]int)
+	for _, line := range strings.Split(output, "\n") {
+		if match := benchmarkRecommended.FindStringSubmatch(line); match != nil {
+			report.RecommendedThreads, _ = strconv.Atoi(match[1])
+			continue
+		}
+		match := benchmarkResultPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		result := BenchmarkResult{}
+		result.Threads, _ = strconv.Atoi(match[1])
+		result.VisitsPerSecond, _ = strconv.ParseFloat(match[2], 64)
+		if m := benchmarkEvalsPattern.FindStringSubmatch(line); m != nil {
+			result.NNEvalsPerSecond, _ = strconv.ParseFloat(m[1], 64)
+		}
+		if m := benchmarkBatchPattern.FindStringSubmatch(line); m != nil {
+			result.AvgBatchSize, _ = strconv.ParseFloat(m[1], 64)
+		}
+		if m := benchmarkEloPattern.FindStringSubmatch(line); m != nil {
+			elo, err := strconv.ParseFloat(m[1], 64)
+			if err == nil {
+				result.EloDiff = &elo
+			}
+		} else if strings.Contains(line, "EloDiff baseline") {
+			elo := 0.0
+			result.EloDiff = &elo
+		}
+		// the ordered summary repeats the results, the later ones win
+		if index, ok := indexes[result.Threads]; ok {
+			report.Results[index] = result
+		} else {
+			indexes[result.Threads] = len(report.Results)
+			report.Results = append(report.Results, result)
+		}
+	}
+	if report.RecommendedThreads == 0 {
+		report.RecommendedThreads = recommendThreads(report.Results)
+	}
+	return report
+}
+
+func recommendThreads(results []BenchmarkResult) int {
+	best := -1
+	for i, result := range results {
+		if best < 0 {
+			best = i
+			continue
+		}
+		if result.EloDiff != nil && results[best].EloDiff != nil {
+			if *result.EloDiff > *results[best].EloDiff {
+				best = i
+			}
+		} else if result.VisitsPerSecond > results[best].VisitsPerSecond {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0
+	}
+	return results[best].Threads
+}
+
+// OverrideConfig returns the override config with the recommended numSearchThreads
+func (report *BenchmarkReport) OverrideConfig(overrideConfig string) (string, error) {
+	config, err := ParseOverrideConfig(overrideConfig)
+	if err != nil {
+		return "", err
+	}
+	return config.NumSearchThreads(report.RecommendedThreads).String(), nil
+}
+
+// WriteBenchmarkReport writes the report to the writer in the given output format
+func WriteBenchmarkReport(w io.Writer, report *BenchmarkReport, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "THREADS\tVISITS/S\tNNEVALS/S\tBATCH\tELO\t")
+	for _, result := range report.Results {
+		elo := ""
+		if result.EloDiff != nil {
+			elo = fmt.Sprintf("%+.0f", *result.EloDiff)
+		}
+		mark := ""
+		if result.Threads == report.RecommendedThreads {
+			mark = "recommended"
+		}
+		fmt.Fprintf(tw, "%d\t%.2f\t%.2f\t%.2f\t%s\t%s\n", result.Threads, result.VisitsPerSecond, result.NNEvalsPerSecond, result.AvgBatchSize, elo, mark)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\nrecommended: numSearchThreads=%d\n", report.RecommendedThreads)
+	return err
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+// benchmarkOutput is the output of katago benchmark -t 5,10,12,16,20
+const benchmarkOutput = `2023-03-12 08:21:40+0000: Loading model and initializing benchmark...
+2023-03-12 08:21:40+0000: Testing with default positions for board size: 19
+2023-03-12 08:21:40+0000: nnRandSeed0 = 8374624592137750164
+2023-03-12 08:21:40+0000: After dedups: nnModelFile0 = kata1-b40c256.bin.gz useFP16 auto useNHWC auto
+2023-03-12 08:21:49+0000: Loaded neural net with nnXLen 19 nnYLen 19
+
+Your GTP config is currently set to use numSearchThreads = 12
+Testing using 800 visits.
+  If you have a good GPU, you might increase this using "-visits N" to get more accurate results.
+
+numSearchThreads =  5: 10 / 10 positions, visits/s = 1205.53 nnEvals/s = 1015.79 nnBatches/s = 204.25 avg batch size = 4.97 (6.7 secs)
+numSearchThreads = 10: 10 / 10 positions, visits/s = 2031.59 nnEvals/s = 1721.43 nnBatches/s = 173.36 avg batch size = 9.93 (4.0 secs)
+numSearchThreads = 12: 10 / 10 positions, visits/s = 2209.13 nnEvals/s = 1868.60 nnBatches/s = 157.13 avg batch size = 11.89 (3.7 secs)
+numSearchThreads = 16: 10 / 10 positions, visits/s = 2412.90 nnEvals/s = 2045.14 nnBatches/s = 128.89 avg batch size = 15.87 (3.4 secs)
+numSearchThreads = 20: 10 / 10 positions, visits/s = 2493.44 nnEvals/s = 2112.72 nnBatches/s = 106.52 avg batch size = 19.83 (3.3 secs)
+
+Ordered summary of results: 
+
+numSearchThreads =  5: 10 / 10 positions, visits/s = 1205.53 nnEvals/s = 1015.79 nnBatches/s = 204.25 avg batch size = 4.97 (6.7 secs) (EloDiff baseline)
+numSearchThreads = 10: 10 / 10 positions, visits/s = 2031.59 nnEvals/s = 1721.43 nnBatches/s = 173.36 avg batch size = 9.93 (4.0 secs) (EloDiff +153)
+numSearchThreads = 12: 10 / 10 positions, visits/s = 2209.13 nnEvals/s = 1868.60 nnBatches/s = 157.13 avg batch size = 11.89 (3.7 secs) (EloDiff +172)
+numSearchThreads = 16: 10 / 10 positions, visits/s = 2412.90 nnEvals/s = 2045.14 nnBatches/s = 128.89 avg batch size = 15.87 (3.4 secs) (EloDiff +178)
+numSearchThreads = 20: 10 / 10 positions, visits/s = 2493.44 nnEvals/s = 2112.72 nnBatches/s = 106.52 avg batch size = 19.83 (3.3 secs) (EloDiff +166)
+
+Based on some test data, each speed doubling gains perhaps ~250 Elo by searching deeper.
+Based on some test data, each thread costs perhaps 7 Elo if using 800 visits, and 2 Elo if using 5000 visits (by making MCTS worse).
+So APPROXIMATELY based on this benchmark, if you intend to do a 5 second search: 
+numSearchThreads =  5: (baseline)
+numSearchThreads = 10:  +153 Elo
+numSearchThreads = 12:  +172 Elo
+numSearchThreads = 16:  +178 Elo (recommended)
+numSearchThreads = 20:  +166 Elo
+
+If you care about performance, you may want to edit numSearchThreads in default_gtp.cfg based on the above results!
+`
+
+func TestParseBenchmark(t *testing.T) {
+	report := ParseBenchmark(benchmarkOutput)
+	if report.RecommendedThreads != 16 {
+		t.Errorf("recommended: got %d, want 16", report.RecommendedThreads)
+	}
+	threads := make([]int, 0)
+	for _, result := range report.Results {
+		threads = append(threads, result.Threads)
+	}
+	if want := []int{5, 10, 12, 16, 20}; !reflect.DeepEqual(threads, want) {
+		t.Fatalf("threads: got %v, want %v", threads, want)
+	}
+	first := report.Results[0]
+	if first.VisitsPerSecond != 1205.53 || first.NNEvalsPerSecond != 1015.79 || first.AvgBatchSize != 4.97 {
+		t.Errorf("got %+v", first)
+	}
+	if first.EloDiff == nil || *first.EloDiff != 0 {
+		t.Errorf("the baseline elo: got %v, want 0", first.EloDiff)
+	}
+	if elo := report.Results[3].EloDiff; elo == nil || *elo != 178 {
+		t.Errorf("the elo of 16 threads: got %v, want 178", elo)
+	}
+}
+
+func TestParseBenchmarkWithoutRecommendation(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   int
+	}{
+		{
+			name: "highest elo",
+			output: `numSearchThreads =  8: 10 / 10 positions, visits/s = 900.10 nnEvals/s = 800.00 nnBatches/s = 100.00 avg batch size = 7.90 (8.9 secs) (EloDiff baseline)
+numSearchThreads = 16: 10 / 10 positions, visits/s = 1500.00 nnEvals/s = 1300.00 nnBatches/s = 81.00 avg batch size = 15.80 (5.3 secs) (EloDiff +120)
+numSearchThreads = 32: 10 / 10 positions, visits/s = 1600.00 nnEvals/s = 1400.00 nnBatches/s = 44.00 avg batch size = 31.70 (5.0 secs) (EloDiff +95)
+`,
+			want: 16,
+		},
+		{
+			name: "fastest without elo",
+			output: `numSearchThreads =  8: 10 / 10 positions, visits/s = 900.10 nnEvals/s = 800.00 nnBatches/s = 100.00 avg batch size = 7.90 (8.9 secs)
+numSearchThreads = 16: 10 / 10 positions, visits/s = 1500.00 nnEvals/s = 1300.00 nnBatches/s = 81.00 avg batch size = 15.80 (5.3 secs)
+`,
+			want: 16,
+		},
+		{
+			name:   "no results",
+			output: "2023-03-12 08:21:40+0000: Loading model and initializing benchmark...\n",
+			want:   0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ParseBenchmark(test.output).RecommendedThreads; got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBenchmarkOverrideConfig(t *testing.T) {
+	report := ParseBenchmark(benchmarkOutput)
+	overrideConfig, err := report.OverrideConfig("numSearchThreads=4,maxVisits=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "numSearchThreads=16,maxVisits=100"; overrideConfig != want {
+		t.Errorf("got %q, want %q", overrideConfig, want)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/kinfkong/ikatago-client/kataconfig"
+	"github.com/kinfkong/ikatago-client/katassh"
+)
+
+// CheckConfigResult represents the result of checking the local katago config
+type CheckConfigResult struct {
+	File   string             `json:"file"`
+	Valid  bool               `json:"valid"`
+	Issues []kataconfig.Issue `json:"issues"`
+	Merged []kataconfig.Entry `json:"merged"`
+}
+
+// CheckConfig checks the local katago config file merged with the override config
+func CheckConfig(localConfig string, overrideConfig *string) (*CheckConfigResult, error) {
+	config, issues, err := kataconfig.Check(localConfig, overrideConfig)
+	if err != nil {
+		log.Printf("ERROR cannot read config file: %s, err: %v\n", localConfig, err)
+		return nil, err
+	}
+	return &CheckConfigResult{
+		File:   localConfig,
+		Valid:  !kataconfig.HasErrors(issues),
+		Issues: issues,
+		Merged: config.Entries(),
+	}, nil
+}
+
+// WriteCheckConfigResult writes the result of checking the config to the writer in the given output format
+func WriteCheckConfigResult(w io.Writer, result *CheckConfigResult, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, result)
+	}
+	if len(result.Issues) == 0 {
+		_, err := fmt.Fprintf(w, "%s: OK\n", result.File)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tLINE\tSEVERITY\tMESSAGE")
+	for _, issue := range result.Issues {
+		line := "-"
+		if issue.Line > 0 {
+			line = fmt.Sprint(issue.Line)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", issue.Source, line, issue.Severity, issue.Message)
+	}
+	return tw.Flush()
+}
+
+// uploadLocalConfig checks the local config and uploads it to the server, and returns the name of the config on the server.
+// configs with errors are refused. the output of the upload command is written to the stderrWriter.
+func (client *Client) uploadLocalConfig(options RunKatagoOptions, stderrWriter io.Writer) (string, error) {
+	result, err := CheckConfig(*options.KataLocalConfig, options.KataOverrideConfig)
+	if err != nil {
+		return "", err
+	}
+	for _, issue := range result.Issues {
+		if issue.Severity == kataconfig.SeverityError {
+			log.Printf("ERROR %s\n", issue)
+		} else {
+			log.Printf("WARNING %s\n", issue)
+		}
+	}
+	if !result.Valid {
+		return "", errors.New("invalid_config")
+	}
+	// run scp to copy the configure
+	s := &katassh.KataSSHSession{Connection: client.sharedConnection(), UploadCacheDir: uploadCacheDir()}
+	return s.RunSCP(client.sshOptions, *options.KataLocalConfig, client.buildServerLocationOptions(options), stderrWriter)
+}
+
+// uploadCacheDir returns ~/.ikatago/uploads, which records the uploaded configs. it is empty if there is no home.
+func uploadCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ikatago", "uploads")
+}
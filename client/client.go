@@ -1,18 +1,24 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kinfkong/ikatago-client/katassh"
 	"github.com/kinfkong/ikatago-client/model"
 	"github.com/kinfkong/ikatago-client/platform"
+	"github.com/kinfkong/ikatago-client/tracing"
 	"github.com/kinfkong/ikatago-client/utils"
 )
 
@@ -27,6 +33,8 @@ type Options struct {
 	GpuType    *string `json:"gpuType"`
 	Token      *string `json:"token"`
 	ExtraInfo  *string `json:"extraInfo"`
+	// ShareConnection makes all the sessions of the client share one ssh connection
+	ShareConnection bool `json:"shareConnection"`
 }
 
 // RunKatagoOptions represents the run katago options
@@ -42,31 +50,96 @@ type RunKatagoOptions struct {
 	ExtraInfo          *string
 	UseRawData         bool
 	ClientID           *string
+	// EngineType, GpuType and ForceNode override the ones in the client options for this session
+	EngineType *string
+	GpuType    *string
+	ForceNode  *string
+	// Context stops the session when it is done
+	Context context.Context
+	// OnEvent receives the lifecycle events of the session
+	OnEvent func(event Event)
+	// RecordFile records the gtp commands and the katago output of the session into the file
+	RecordFile *string
+	// FallbackKatago is the local katago binary which takes over the gtp traffic if the remote katago fails,
+	// FallbackModel and FallbackConfig are its model and config
+	FallbackKatago *string
+	FallbackModel  *string
+	FallbackConfig *string
+	// PreloadID is the id of the preloaded katago, it is generated by PreloadKatago if nil
+	PreloadID *string
+	// Attach is the id of the preloaded katago which run-katago attaches to, or AttachLatest
+	Attach *string
+
+	// remoteConfigName is the name of the uploaded KataLocalConfig on the server
+	remoteConfigName string
 }
 
 // Client represents the ikatago client
 type Client struct {
 	Options    Options
 	init       bool
+	initLock   sync.Mutex
 	sshOptions model.SSHOptions
+	connection *katassh.Connection
+	tracer     *tracing.Tracer
+
+	// preloads are the running preloaded katago started by this client, the latest last
+	preloadsLock sync.Mutex
+	preloads     []Preload
 }
 
+// SessionResult represents a running session. Stop and Wait can be called from any goroutine.
 type SessionResult struct {
 	session *katassh.KataSSHSession
-	Err     error
-	wg      sync.WaitGroup
+	// Err is the error of the session, it is only safe to read after Wait returns
+	Err error
+	// ExitStatus is the exit status of katago, -1 if katago did not exit by itself, like the connection is lost.
+	// it is only safe to read after Wait returns
+	ExitStatus int
+	// Signal is the name of the signal which killed katago, like KILL, it is empty if not killed by a signal
+	Signal string
+	// PreloadID is the id of the preloaded katago, only set by PreloadKatago
+	PreloadID string
+	wg        sync.WaitGroup
+	done      chan struct{}
+	stop      func()
 }
 
+// Stop stops the session
 func (s *SessionResult) Stop() {
-	if s.session != nil {
+	if s.stop != nil {
+		s.stop()
+	} else if s.session != nil {
 		s.session.Stop()
-		s.session = nil
 	}
 }
+
+// Ping measures the round trip time of a keepalive request on the session
+func (s *SessionResult) Ping() (time.Duration, error) {
+	if s.session == nil {
+		return 0, errors.New("not_connected")
+	}
+	return s.session.Ping()
+}
+
+// Traffic returns the bytes transmitted by the session so far
+func (s *SessionResult) Traffic() katassh.Traffic {
+	if s.session == nil {
+		return katassh.Traffic{}
+	}
+	return s.session.Traffic()
+}
+
+// Wait waits until the session finishes
 func (s *SessionResult) Wait() {
 	s.wg.Wait()
 }
 
+// Done returns a channel which is closed when the session finishes
+func (s *SessionResult) Done() <-chan struct{} {
+	return s.done
+}
+
 // NewClient creates the client
 func NewClient(options Options) (*Client, error) {
 	return &Client{
@@ -77,62 +150,248 @@ func NewClient(options Options) (*Client, error) {
 
 // RunKatago runs the katago
 func (client *Client) RunKatago(options RunKatagoOptions, subCommands []string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, onReady func()) (*SessionResult, error) {
-	if !client.init {
-		err := client.initClient()
+	if options.Attach != nil && *options.Attach == AttachLatest {
+		preload, err := client.latestPreload()
 		if err != nil {
+			notify(options.OnEvent, EventFailed, err)
 			return nil, err
 		}
+		log.Printf("DEBUG attaching to the preloaded katago: %s\n", preload.ID)
+		options.Attach = &preload.ID
 	}
-	if options.KataLocalConfig != nil {
-		// run scp to copy the configure
-		err := (&katassh.KataSSHSession{}).RunSCP(client.sshOptions, *options.KataLocalConfig, client.BuildServerLocationOptions())
-		if err != nil {
-			return nil, err
+	if options.FallbackKatago != nil {
+		return client.runKatagoWithFallback(options, subCommands, inputReader, outputWriter, stderrWriter, onReady)
+	}
+	return client.runKatagoCommand("run-katago", options, subCommands, inputReader, outputWriter, stderrWriter, onReady)
+}
+
+// PreloadKatago starts the katago on the server to load the model in advance,
+// the run-katago sessions can attach to it with the PreloadID of the result, or with AttachLatest.
+// the preload is recorded in the preload store when katago is ready, and removed when the session ends.
+func (client *Client) PreloadKatago(options RunKatagoOptions, subCommands []string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, onReady func()) (*SessionResult, error) {
+	if options.PreloadID == nil {
+		preloadID := NewPreloadID()
+		options.PreloadID = &preloadID
+	}
+	preload := Preload{
+		ID:        *options.PreloadID,
+		PID:       os.Getpid(),
+		Platform:  client.Options.Platform,
+		Username:  client.Options.Username,
+		CreatedAt: time.Now(),
+	}
+	if options.KataName != nil {
+		preload.KataName = *options.KataName
+	}
+	if options.KataWeight != nil {
+		preload.KataWeight = *options.KataWeight
+	}
+	if options.KataConfig != nil {
+		preload.KataConfig = *options.KataConfig
+	}
+	ready := func() {
+		client.addPreload(preload)
+		if onReady != nil {
+			onReady()
 		}
 	}
-	s := &katassh.KataSSHSession{}
-	result := SessionResult{
-		session: s,
+	session, err := client.runKatagoCommand("preload-katago", options, subCommands, inputReader, outputWriter, stderrWriter, ready)
+	if err != nil {
+		return nil, err
+	}
+	result := &SessionResult{
+		session:   session.session,
+		PreloadID: preload.ID,
+		done:      make(chan struct{}),
+		stop:      session.Stop,
 	}
-	// build the ssh command
 	result.wg.Add(1)
 	go func() {
-		err := s.RunKatago(client.sshOptions, client.BuildKatagoCommand("run-katago", options, subCommands), inputReader, outputWriter, stderrWriter, options.UseRawData, onReady)
-		if err != nil {
-			result.Err = err
-		}
-		result.wg.Done()
+		defer result.wg.Done()
+		defer close(result.done)
+		session.Wait()
+		client.removePreload(preload.ID)
+		result.Err = session.Err
+		result.ExitStatus = session.ExitStatus
+		result.Signal = session.Signal
 	}()
+	return result, nil
+}
 
-	return &result, nil
+// addPreload records the running preload in the client and in the store
+func (client *Client) addPreload(preload Preload) {
+	client.preloadsLock.Lock()
+	client.preloads = append(client.preloads, preload)
+	client.preloadsLock.Unlock()
+	store, err := DefaultPreloadStore()
+	if err == nil {
+		err = store.Add(preload)
+	}
+	if err != nil {
+		// the preload can still be attached by this client
+		log.Printf("ERROR failed to save the preload: %v\n", err)
+	}
 }
 
-// PreloadKatago runs the katago
-func (client *Client) PreloadKatago(options RunKatagoOptions, subCommands []string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, onReady func()) (*SessionResult, error) {
-	if !client.init {
-		err := client.initClient()
+// removePreload removes the preload whose session has ended
+func (client *Client) removePreload(id string) {
+	client.preloadsLock.Lock()
+	preloads := make([]Preload, 0, len(client.preloads))
+	for _, preload := range client.preloads {
+		if preload.ID != id {
+			preloads = append(preloads, preload)
+		}
+	}
+	client.preloads = preloads
+	client.preloadsLock.Unlock()
+	store, err := DefaultPreloadStore()
+	if err != nil {
+		return
+	}
+	err = store.Remove(id)
+	if err != nil && err.Error() != "preload_not_found" {
+		log.Printf("ERROR failed to remove the preload: %v\n", err)
+	}
+}
+
+// latestPreload finds the latest running preloaded katago of this client, or of the platform and the user in the store
+func (client *Client) latestPreload() (*Preload, error) {
+	client.preloadsLock.Lock()
+	if len(client.preloads) > 0 {
+		preload := client.preloads[len(client.preloads)-1]
+		client.preloadsLock.Unlock()
+		return &preload, nil
+	}
+	client.preloadsLock.Unlock()
+	store, err := DefaultPreloadStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Find(client.Options.Platform, client.Options.Username, AttachLatest)
+}
+
+func (client *Client) runKatagoCommand(command string, options RunKatagoOptions, subCommands []string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, onReady func()) (*SessionResult, error) {
+	tracer := client.tracer
+	notify(options.OnEvent, EventConnecting, nil)
+	err := client.ensureInit()
+	if err != nil {
+		notify(options.OnEvent, EventFailed, err)
+		tracer.Finish(err)
+		return nil, err
+	}
+	if options.KataLocalConfig != nil {
+		notify(options.OnEvent, EventUploadingConfig, nil)
+		span := tracer.StartSpan("upload-config")
+		options.remoteConfigName, err = client.uploadLocalConfig(options, stderrWriter)
+		span.End(err)
 		if err != nil {
+			notify(options.OnEvent, EventFailed, err)
+			tracer.Finish(err)
 			return nil, err
 		}
+		notify(options.OnEvent, EventConfigUploaded, nil)
 	}
-	if options.KataLocalConfig != nil {
-		// run scp to copy the configure
-		err := (&katassh.KataSSHSession{}).RunSCP(client.sshOptions, *options.KataLocalConfig, client.BuildServerLocationOptions())
+	if options.Context != nil && options.Context.Err() != nil {
+		notify(options.OnEvent, EventFailed, options.Context.Err())
+		tracer.Finish(options.Context.Err())
+		return nil, options.Context.Err()
+	}
+	var recorder *Recorder
+	if options.RecordFile != nil {
+		recorder, err = NewRecorder(*options.RecordFile)
 		if err != nil {
+			notify(options.OnEvent, EventFailed, err)
+			tracer.Finish(err)
 			return nil, err
 		}
+		inputReader = recorder.Reader(RecordStdin, inputReader)
+		outputWriter = recorder.Writer(RecordStdout, outputWriter)
+		stderrWriter = recorder.Writer(RecordStderr, stderrWriter)
+	}
+	var stderrTail *tailWriter
+	if options.PreloadID != nil || options.Attach != nil {
+		// the server which does not support preloading refuses the flags, it is told from the stderr
+		stderrTail = &tailWriter{writer: stderrWriter}
+		stderrWriter = stderrTail
+	}
+	if !options.UseRawData {
+		timer := newGTPTimer()
+		inputReader = &gtpTimerReader{timer: timer, reader: inputReader}
+		outputWriter = &gtpTimerWriter{timer: timer, writer: outputWriter}
+	}
+	if tracer != nil {
+		// the trace of the startup ends at the first output of katago, it is exported when the session finishes
+		outputWriter = &firstWriteWriter{writer: outputWriter, onFirstWrite: func() {
+			tracer.End(nil)
+		}}
+	}
+	sessionsTotal.Inc(command)
+	// the spans are started and ended in the goroutine running the session
+	dialSpan := tracer.StartSpan("ssh-dial")
+	var startSpan *tracing.Span
+	s := &katassh.KataSSHSession{
+		Connection: client.sharedConnection(),
+		NoCompress: options.NoCompress,
+		OnConnected: func() {
+			dialSpan.End(nil)
+			startSpan = tracer.StartSpan("start-remote-command")
+			notify(options.OnEvent, EventConnected, nil)
+		},
 	}
-	s := &katassh.KataSSHSession{}
 	result := SessionResult{
 		session: s,
+		done:    make(chan struct{}),
+	}
+	started := false
+	ready := func() {
+		started = true
+		startSpan.End(nil)
+		tracer.StartSpan("first-gtp-response")
+		sessionsActive.Inc()
+		notify(options.OnEvent, EventEngineStarted, nil)
+		if onReady != nil {
+			onReady()
+		}
+	}
+	if options.Context != nil {
+		go func() {
+			select {
+			case <-options.Context.Done():
+				result.Stop()
+			case <-result.done:
+			}
+		}()
 	}
 	// build the ssh command
 	result.wg.Add(1)
 	go func() {
-		err := s.RunKatago(client.sshOptions, client.BuildKatagoCommand("preload-katago", options, subCommands), inputReader, outputWriter, stderrWriter, options.UseRawData, onReady)
+		defer close(result.done)
+		err := s.RunKatago(client.sshOptions, client.BuildKatagoCommand(command, options, subCommands), inputReader, outputWriter, stderrWriter, options.UseRawData, ready)
+		if stderrTail != nil && katassh.IsUnknownFlagError(err, stderrTail.String(), "preload-id", "attach") {
+			log.Printf("ERROR the server does not support preloading katago: %v\n", err)
+			err = errors.New("preload_not_supported")
+		}
 		if err != nil {
 			result.Err = err
 		}
+		result.ExitStatus = ExitCodeOf(err)
+		result.Signal = ExitSignalOf(err)
+		if recorder != nil {
+			recorder.Close()
+		}
+		if started {
+			sessionsActive.Dec()
+		}
+		dialSpan.End(err)
+		startSpan.End(err)
+		tracer.Finish(err)
+		if !started {
+			notify(options.OnEvent, EventFailed, err)
+		} else if s.IsStopped() || (err != nil && ClassifyError(err) != ErrorClassRemote) {
+			notify(options.OnEvent, EventDisconnected, err)
+		} else {
+			notify(options.OnEvent, EventExited, err)
+		}
 		result.wg.Done()
 	}()
 
@@ -141,15 +400,12 @@ func (client *Client) PreloadKatago(options RunKatagoOptions, subCommands []stri
 
 // ViewConfig views the katago config
 func (client *Client) ViewConfig(options RunKatagoOptions, subCommands []string, outputWriter io.Writer) error {
-	if !client.init {
-		err := client.initClient()
-		if err != nil {
-			return err
-		}
+	err := client.ensureInit()
+	if err != nil {
+		return err
 	}
 	if options.KataLocalConfig != nil {
-		// run scp to copy the configure
-		err := (&katassh.KataSSHSession{}).RunSCP(client.sshOptions, *options.KataLocalConfig, client.BuildServerLocationOptions())
+		options.remoteConfigName, err = client.uploadLocalConfig(options, ioutil.Discard)
 		if err != nil {
 			return err
 		}
@@ -162,10 +418,10 @@ func (client *Client) ViewConfig(options RunKatagoOptions, subCommands []string,
 	defer mockReader.Close()
 	defer stderrWriter.Close()
 
-	s := &katassh.KataSSHSession{}
+	s := &katassh.KataSSHSession{Connection: client.sharedConnection()}
 
 	// build the ssh command
-	err := s.RunSSH(client.sshOptions, client.BuildKatagoCommand("view-config", options, subCommands), stdinReader, stderrWriter, outputWriter)
+	err = s.RunSSH(client.sshOptions, client.BuildKatagoCommand("view-config", options, subCommands), stdinReader, stderrWriter, outputWriter)
 	if err != nil {
 		return err
 	}
@@ -174,11 +430,9 @@ func (client *Client) ViewConfig(options RunKatagoOptions, subCommands []string,
 
 // QueryServer queries the server
 func (client *Client) QueryServer(outputWriter io.Writer) error {
-	if !client.init {
-		err := client.initClient()
-		if err != nil {
-			return err
-		}
+	err := client.ensureInit()
+	if err != nil {
+		return err
 	}
 
 	// build the ssh command
@@ -196,7 +450,7 @@ func (client *Client) QueryServer(outputWriter io.Writer) error {
 	defer stdinReader.Close()
 	defer mockReader.Close()
 	defer stderrWriter.Close()
-	err := (&katassh.KataSSHSession{}).RunSSH(client.sshOptions, cmd, stdinReader, stderrWriter, outputWriter)
+	err = (&katassh.KataSSHSession{Connection: client.sharedConnection()}).RunSSH(client.sshOptions, cmd, stdinReader, stderrWriter, outputWriter)
 	if err != nil {
 		return err
 	}
@@ -221,7 +475,12 @@ func (client *Client) BuildKatagoCommand(cmd string, options RunKatagoOptions, s
 		cmd = cmd + fmt.Sprintf(" --config %s", *kataConfig)
 	}
 	if kataLocalConfig != nil && len(*kataLocalConfig) > 0 {
-		cmd = cmd + fmt.Sprintf(" --custom-config %s", filepath.Base(*kataLocalConfig))
+		// the name returned by the upload, the content may have changed since then
+		remoteConfigName := options.remoteConfigName
+		if len(remoteConfigName) == 0 {
+			remoteConfigName = filepath.Base(*kataLocalConfig)
+		}
+		cmd = cmd + fmt.Sprintf(" --custom-config %s", remoteConfigName)
 	}
 	if extraInfo != nil && len(*extraInfo) > 0 {
 		cmd = cmd + fmt.Sprintf(" --extra-info %s", *extraInfo)
@@ -229,6 +488,13 @@ func (client *Client) BuildKatagoCommand(cmd string, options RunKatagoOptions, s
 	if clientID != nil && len(*clientID) > 0 {
 		cmd = cmd + fmt.Sprintf(" --client-id %s", *clientID)
 	}
+	// only sent when preloading, the servers without preload-katago refuse them, see preload_not_supported
+	if options.PreloadID != nil && len(*options.PreloadID) > 0 {
+		cmd = cmd + fmt.Sprintf(" --preload-id %s", *options.PreloadID)
+	}
+	if options.Attach != nil && len(*options.Attach) > 0 {
+		cmd = cmd + fmt.Sprintf(" --attach %s", *options.Attach)
+	}
 	if !options.NoCompress {
 		cmd = cmd + " --compress"
 	}
@@ -236,81 +502,151 @@ func (client *Client) BuildKatagoCommand(cmd string, options RunKatagoOptions, s
 	cmd = cmd + fmt.Sprintf(" --transmit-move-num %d", options.TransmitMoveNum)
 
 	// build options with server related options
-	serverLocationOptions := client.BuildServerLocationOptions()
+	serverLocationOptions := client.buildServerLocationOptions(options)
 	if len(serverLocationOptions) > 0 {
 		cmd = cmd + serverLocationOptions
 	}
 	if len(subCommands) > 0 {
 		cmd = cmd + " -- " + strings.Join(subCommands, " ")
 		if kataOverrideConfig != nil && len(*kataOverrideConfig) > 0 {
-			cmd = cmd + " -override-config " + *kataOverrideConfig
+			cmd = cmd + " -override-config " + shellQuote(*kataOverrideConfig)
 		}
 	} else if kataOverrideConfig != nil && len(*kataOverrideConfig) > 0 {
-		cmd = cmd + " -- gtp -override-config " + *kataOverrideConfig
+		cmd = cmd + " -- gtp -override-config " + shellQuote(*kataOverrideConfig)
 	}
 	return cmd
 }
 
 func (client *Client) BuildServerLocationOptions() string {
+	return client.buildServerLocationOptions(RunKatagoOptions{})
+}
+
+// buildServerLocationOptions builds the server related options, the ones in the session options win
+func (client *Client) buildServerLocationOptions(options RunKatagoOptions) string {
+	engineType := client.Options.EngineType
+	if options.EngineType != nil {
+		engineType = options.EngineType
+	}
+	forceNode := client.Options.ForceNode
+	if options.ForceNode != nil {
+		forceNode = options.ForceNode
+	}
+	gpuType := client.Options.GpuType
+	if options.GpuType != nil {
+		gpuType = options.GpuType
+	}
 	cmd := ""
 	// build options with server related options
-	if client.Options.EngineType != nil && len(*client.Options.EngineType) > 0 {
-		cmd = cmd + fmt.Sprintf(" --engine-type %s", *client.Options.EngineType)
+	if engineType != nil && len(*engineType) > 0 {
+		cmd = cmd + fmt.Sprintf(" --engine-type %s", *engineType)
 	}
-	if client.Options.ForceNode != nil && len(*client.Options.ForceNode) > 0 {
-		cmd = cmd + fmt.Sprintf(" --force-node %s", *client.Options.ForceNode)
+	if forceNode != nil && len(*forceNode) > 0 {
+		cmd = cmd + fmt.Sprintf(" --force-node %s", *forceNode)
 	}
-	if client.Options.GpuType != nil && len(*client.Options.GpuType) > 0 {
-		cmd = cmd + fmt.Sprintf(" --gpu-type %s", *client.Options.GpuType)
+	if gpuType != nil && len(*gpuType) > 0 {
+		cmd = cmd + fmt.Sprintf(" --gpu-type %s", *gpuType)
 	}
 	if client.Options.Token != nil && len(*client.Options.Token) > 0 {
 		cmd = cmd + fmt.Sprintf(" --token %s", *client.Options.Token)
 	}
 	return cmd
 }
+
+// ShareConnection makes all the sessions of the client share one ssh connection from now on
+func (client *Client) ShareConnection() {
+	client.initLock.Lock()
+	defer client.initLock.Unlock()
+	client.Options.ShareConnection = true
+	if client.init && client.connection == nil {
+		client.connection = katassh.NewConnection(client.sshOptions)
+	}
+}
+
+func (client *Client) sharedConnection() *katassh.Connection {
+	client.initLock.Lock()
+	defer client.initLock.Unlock()
+	return client.connection
+}
+
+// SetTracer sets the tracer which records the startup phases of the next session
+func (client *Client) SetTracer(tracer *tracing.Tracer) {
+	client.tracer = tracer
+}
+
+// ensureInit discovers the ssh info once, it is safe to be called from multiple goroutines
+func (client *Client) ensureInit() error {
+	client.initLock.Lock()
+	defer client.initLock.Unlock()
+	if client.init {
+		return nil
+	}
+	return client.initClient()
+}
+
 func (client *Client) initClient() error {
 	platform, err := client.getPlatformFromWorld()
 	if err != nil {
 		return err
 	}
+	span := client.tracer.StartSpan("fetch-ssh-info")
 	sshOptions, err := client.getSSHOptions(platform)
+	span.End(err)
 	if err != nil {
 		return err
 	}
+	span.SetAttribute("host", sshOptions.Host)
 	client.sshOptions = *sshOptions
+	if client.Options.ShareConnection {
+		client.connection = katassh.NewConnection(client.sshOptions)
+	}
 	client.init = true
 	return nil
 }
 
 func (client *Client) getPlatformFromWorld() (*platform.Platform, error) {
-	type World struct {
-		Platforms []platform.Platform `json:"platforms"`
-	}
-	worldJSONString, err := utils.DoHTTPRequest("GET", client.Options.World, nil, nil)
+	span := client.tracer.StartSpan("fetch-world")
+	span.SetAttribute("world", client.Options.World)
+	world, err := FetchWorld(client.Options.World)
+	span.End(err)
 	if err != nil {
 		return nil, err
 	}
-	world := &World{}
-	err = json.Unmarshal([]byte(worldJSONString), &world)
-	if err != nil {
+	span = client.tracer.StartSpan("resolve-platform")
+	span.SetAttribute("platform", client.Options.Platform)
+	defer func() {
+		span.End(err)
+	}()
+	p := world.FindPlatform(client.Options.Platform)
+	if p == nil {
+		log.Printf("ERROR platform not found in the world. platform: %s", client.Options.Platform)
+		err = errors.New("platform_not_found")
 		return nil, err
 	}
-	for _, platform := range world.Platforms {
-		if platform.Name == client.Options.Platform {
-			return &platform, nil
-		}
-	}
-	log.Printf("ERROR platform not found in the world. platform: %s", client.Options.Platform)
-	return nil, errors.New("platform_not_found")
+	span.SetAttribute("discovery", p.DiscoveryType())
+	return p, nil
 }
 
 // getSSHOptions gets the ssh info
 func (client *Client) getSSHOptions(p *platform.Platform) (*model.SSHOptions, error) {
-	sshJSONURL := ""
-	if p.Http != nil && p.Http.GetUrl != nil {
-		sshJSONURL = *p.Http.GetUrl + "/users/" + client.Options.Username + ".ssh.json"
-	} else {
-		sshJSONURL = "https://" + p.Oss.Bucket + "." + p.Oss.BucketEndpoint + "/users/" + client.Options.Username + ".ssh.json"
+	if p.Http != nil && p.Http.GetPostUrl != nil && len(*p.Http.GetPostUrl) > 0 {
+		sshoptions, statusCode, err := client.getSSHOptionsByPost(p)
+		if err == nil {
+			sshoptions.Password = client.Options.Password
+			return sshoptions, nil
+		}
+		if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+			log.Printf("ERROR the discovery rejects the user: %s\n", client.Options.Username)
+			return nil, errors.New("discovery_unauthorized")
+		}
+		if !isDiscoveryEndpointMissing(statusCode, err) {
+			return nil, err
+		}
+		log.Printf("ERROR the discovery endpoint is not available, fallback to the public discovery. err: %+v\n", err)
+	}
+	sshJSONURL := p.SSHJSONURL(client.Options.Username)
+	if len(sshJSONURL) == 0 {
+		log.Printf("ERROR the platform has no public ssh info. platform: %s\n", p.Name)
+		return nil, errors.New("discovery_unavailable")
 	}
 	response, err := utils.DoHTTPRequest("GET", sshJSONURL, nil, nil)
 	if err != nil {
@@ -0,0 +1,411 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/kinfkong/ikatago-client/config"
+	"github.com/kinfkong/ikatago-client/kataconfig"
+	"github.com/kinfkong/ikatago-client/model"
+)
+
+// the exit codes of the process. if katago exits with error, the exit code is ExitCodeRemote,
+// the exit status of katago is in SessionResult.ExitStatus and logged by the cli.
+const (
+	// ExitCodeFailure means the command fails for an unknown reason, or the check commands find problems
+	ExitCodeFailure = 1
+	// ExitCodeUsage means the command is run with wrong flags or arguments
+	ExitCodeUsage = 2
+	// ExitCodeDiscovery means the world, platform or ssh info cannot be fetched
+	ExitCodeDiscovery = 69
+	// ExitCodeRemote means katago exits with error or is killed by a signal
+	ExitCodeRemote = 70
+	// ExitCodeConnection means the server cannot be reached or the connection is lost
+	ExitCodeConnection = 75
+	// ExitCodeAuth means the server refuses the username or password
+	ExitCodeAuth = 77
+	// ExitCodeConfig means the local config or options are invalid
+	ExitCodeConfig = 78
+)
+
+var exitCodes = map[string]int{
+	ErrorClassConfig:     ExitCodeConfig,
+	ErrorClassDiscovery:  ExitCodeDiscovery,
+	ErrorClassAuth:       ExitCodeAuth,
+	ErrorClassConnection: ExitCodeConnection,
+}
+
+// Command represents a command which can be run by the cli and the sdk, like run-katago, query-server
+type Command struct {
+	Name        string
+	Description string
+	// Login means the command connects to the server, so the password is required
+	Login bool
+	Run   func(ctx *CommandContext) error
+}
+
+// CommandContext is what a command runs with
+type CommandContext struct {
+	// Client is the client of the server, it is not logged in if the command does not need to login
+	Client *Client
+	// Balancer runs run-katago on several accounts instead of Client, it is nil without --balance-profiles
+	Balancer    *Balancer
+	Options     RunKatagoOptions
+	SubCommands []string
+	// Flags are the parsed flags, the commands read their own flags from it, like --output, --ping-count
+	Flags  *model.AllOpts
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// UsageError means the command is run with wrong flags or arguments
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// NewUsageError creates the usage error
+func NewUsageError(message string) error {
+	return &UsageError{Message: message}
+}
+
+var (
+	commandsLock sync.Mutex
+	commands     = make(map[string]*Command)
+)
+
+// RegisterCommand registers the command, so that it can be run by the cli and the sdk.
+// the packages outside client register their commands in init, like gtpshell. it panics if the name is registered.
+func RegisterCommand(command *Command) {
+	commandsLock.Lock()
+	defer commandsLock.Unlock()
+	if _, ok := commands[command.Name]; ok {
+		panic("command already registered: " + command.Name)
+	}
+	commands[command.Name] = command
+}
+
+// FindCommand finds the command by name, it returns nil if not found
+func FindCommand(name string) *Command {
+	commandsLock.Lock()
+	defer commandsLock.Unlock()
+	return commands[name]
+}
+
+// Commands returns the registered commands sorted by name
+func Commands() []*Command {
+	commandsLock.Lock()
+	defer commandsLock.Unlock()
+	result := make([]*Command, 0, len(commands))
+	for _, command := range commands {
+		result = append(result, command)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// RunCommand runs the registered command
+func RunCommand(name string, ctx *CommandContext) error {
+	command := FindCommand(name)
+	if command == nil {
+		log.Printf("ERROR unknown command: %s", name)
+		return NewUsageError(fmt.Sprintf("unknown command: [%s], run --cmd help for the commands", name))
+	}
+	return command.Run(ctx)
+}
+
+// CommandExitCode returns the exit code of the process for the error of the command
+func CommandExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var usageError *UsageError
+	if errors.As(err, &usageError) {
+		return ExitCodeUsage
+	}
+	class := ClassifyError(err)
+	if class == ErrorClassRemote {
+		if ExitCodeOf(err) <= 0 {
+			// katago did not exit by itself
+			return ExitCodeConnection
+		}
+		return ExitCodeRemote
+	}
+	if exitCode, ok := exitCodes[class]; ok {
+		return exitCode
+	}
+	return ExitCodeFailure
+}
+
+// CheckLoginOptions checks the flags required by the commands which login, the other commands do not require them
+func CheckLoginOptions(opts *model.AllOpts) error {
+	if len(opts.Platform) == 0 || len(opts.Username) == 0 || len(opts.Password) == 0 {
+		return NewUsageError("the required flags `-p, --platform', `-u, --username' and `--password' were not specified")
+	}
+	return nil
+}
+
+// WriteCommands writes the help of the registered commands
+func WriteCommands(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMMAND\tDESCRIPTION")
+	for _, command := range Commands() {
+		fmt.Fprintf(tw, "%s\t%s\n", command.Name, command.Description)
+	}
+	return tw.Flush()
+}
+
+// NewRunKatagoOptions creates the options of the katago commands from the flags
+func NewRunKatagoOptions(opts *model.AllOpts) RunKatagoOptions {
+	return RunKatagoOptions{
+		NoCompress:         opts.NoCompress,
+		RefreshInterval:    opts.RefreshInterval,
+		TransmitMoveNum:    opts.TransmitMoveNum,
+		KataLocalConfig:    opts.KataLocalConfig,
+		KataOverrideConfig: opts.KataOverrideConfig,
+		KataConfig:         opts.KataConfig,
+		KataWeight:         opts.KataWeight,
+		KataName:           opts.KataName,
+		ExtraInfo:          opts.ExtraInfo,
+		ClientID:           opts.ClientID,
+		UseRawData:         false,
+		RecordFile:         opts.Record,
+		FallbackKatago:     opts.FallbackKatago,
+		FallbackModel:      opts.FallbackModel,
+		FallbackConfig:     opts.FallbackConfig,
+		Attach:             opts.Attach,
+	}
+}
+
+func init() {
+	RegisterCommand(&Command{Name: "help", Description: "Lists the commands", Run: runHelp})
+	RegisterCommand(&Command{Name: "run-katago", Description: "Runs katago on the server, the gtp commands are read from stdin", Login: true, Run: runRunKatago})
+	RegisterCommand(&Command{Name: "preload-katago", Description: "Starts katago on the server to load the model in advance", Login: true, Run: runPreloadKatago})
+	RegisterCommand(&Command{Name: "list-preloads", Description: "Lists the preloaded katago which run-katago can attach to with --attach", Run: runListPreloads})
+	RegisterCommand(&Command{Name: "query-server", Description: "Shows the gpu types, weights and configs of the server", Login: true, Run: runQueryServer})
+	RegisterCommand(&Command{Name: "view-config", Description: "Prints the katago config on the server", Login: true, Run: runViewConfig})
+	RegisterCommand(&Command{Name: "replay", Description: "Replays the --replay-file and compares the responses", Login: true, Run: runReplay})
+	RegisterCommand(&Command{Name: "doctor", Description: "Checks each step of the connection", Login: true, Run: runDoctor})
+	RegisterCommand(&Command{Name: "ping", Description: "Measures the round trips and the analysis throughput", Login: true, Run: runPing})
+	RegisterCommand(&Command{Name: "benchmark", Description: "Runs the katago benchmark and recommends numSearchThreads", Login: true, Run: runBenchmark})
+	RegisterCommand(&Command{Name: "list-platforms", Description: "Lists the platforms in the world", Run: runListPlatforms})
+	RegisterCommand(&Command{Name: "describe-platform", Description: "Shows the details of the --platform", Run: runDescribePlatform})
+	RegisterCommand(&Command{Name: "check-config", Description: "Validates the --kata-local-config and --kata-override-config", Run: runCheckConfig})
+}
+
+func runHelp(ctx *CommandContext) error {
+	return WriteCommands(ctx.Stdout)
+}
+
+func runRunKatago(ctx *CommandContext) error {
+	if ctx.Balancer != nil {
+		return runBalancedKatago(ctx)
+	}
+	sessionResult, err := ctx.Client.RunKatago(ctx.Options, ctx.SubCommands, ctx.Stdin, ctx.Stdout, ctx.Stderr, nil)
+	if err != nil {
+		return err
+	}
+	sessionResult.Wait()
+	return sessionResult.Err
+}
+
+func runBalancedKatago(ctx *CommandContext) error {
+	for _, status := range ctx.Balancer.Check() {
+		queue := "unknown"
+		if status.Queue != nil {
+			queue = fmt.Sprint(*status.Queue)
+		}
+		log.Printf("DEBUG profile: [%s] available: %v latency: %dms queue: %s usage: %s\n", status.Name, status.Available, status.LatencyMillis, queue, status.Usage)
+	}
+	sessionResult, name, err := ctx.Balancer.RunKatago(ctx.Options, ctx.SubCommands, ctx.Stdin, ctx.Stdout, ctx.Stderr, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("DEBUG katago is running on profile: [%s]\n", name)
+	sessionResult.Wait()
+	return sessionResult.Err
+}
+
+func runPreloadKatago(ctx *CommandContext) error {
+	preloadID := NewPreloadID()
+	ctx.Options.PreloadID = &preloadID
+	onReady := func() {
+		// the id is printed for the scripts, run-katago attaches to it with --attach
+		fmt.Fprintln(ctx.Stdout, preloadID)
+	}
+	sessionResult, err := ctx.Client.PreloadKatago(ctx.Options, ctx.SubCommands, ctx.Stdin, ctx.Stdout, ctx.Stderr, onReady)
+	if err != nil {
+		return err
+	}
+	sessionResult.Wait()
+	return sessionResult.Err
+}
+
+func runListPreloads(ctx *CommandContext) error {
+	store, err := DefaultPreloadStore()
+	if err != nil {
+		return err
+	}
+	preloads, err := store.Prune()
+	if err != nil {
+		return err
+	}
+	return WritePreloads(ctx.Stdout, preloads, ctx.Flags.Output)
+}
+
+func runQueryServer(ctx *CommandContext) error {
+	info, err := ctx.Client.QueryServerInfo()
+	if err != nil {
+		return err
+	}
+	return WriteServerInfo(ctx.Stdout, info, ctx.Flags.Output)
+}
+
+func runViewConfig(ctx *CommandContext) error {
+	return ctx.Client.ViewConfig(ctx.Options, ctx.SubCommands, ctx.Stdout)
+}
+
+func runReplay(ctx *CommandContext) error {
+	if ctx.Flags.ReplayFile == nil {
+		return NewUsageError("the required flag `--replay-file' was not specified")
+	}
+	entries, err := ReadRecord(*ctx.Flags.ReplayFile)
+	if err != nil {
+		return err
+	}
+	diffs, err := ctx.Client.Replay(ctx.Options, ctx.SubCommands, entries, ioutil.Discard, ctx.Stderr)
+	if diffs == nil {
+		return err
+	}
+	if err != nil {
+		log.Printf("ERROR replay failed: %v", err)
+	}
+	err = WriteReplayDiffs(ctx.Stdout, diffs, ctx.Flags.Output)
+	if err != nil {
+		return err
+	}
+	if len(diffs) > 0 {
+		return errors.New("replay_differs")
+	}
+	return nil
+}
+
+func runDoctor(ctx *CommandContext) error {
+	report := ctx.Client.Doctor(ctx.Options, ctx.SubCommands)
+	err := WriteDoctorReport(ctx.Stdout, report, ctx.Flags.Output)
+	if err != nil {
+		return err
+	}
+	if !report.OK {
+		return errors.New("doctor_failed")
+	}
+	return nil
+}
+
+func runPing(ctx *CommandContext) error {
+	settings := make([]PingSetting, 0)
+	if ctx.Flags.PingSettings != nil {
+		parsed, err := ParsePingSettings(*ctx.Flags.PingSettings)
+		if err != nil {
+			return NewUsageError("invalid --ping-settings: " + err.Error())
+		}
+		settings = parsed
+	}
+	report, err := ctx.Client.Ping(ctx.Options, ctx.SubCommands, ctx.Flags.PingCount, settings)
+	if err != nil {
+		return err
+	}
+	return WritePingReport(ctx.Stdout, report, ctx.Flags.Output)
+}
+
+func runBenchmark(ctx *CommandContext) error {
+	report, err := ctx.Client.Benchmark(ctx.Options, ctx.SubCommands, ctx.Stderr)
+	if err != nil {
+		return err
+	}
+	err = WriteBenchmarkReport(ctx.Stdout, report, ctx.Flags.Output)
+	if err != nil {
+		return err
+	}
+	if ctx.Flags.SaveConfig != nil {
+		err = kataconfig.SetValue(*ctx.Flags.SaveConfig, "numSearchThreads", strconv.Itoa(report.RecommendedThreads))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctx.Stderr, "Saved numSearchThreads=%d into %s\n", report.RecommendedThreads, *ctx.Flags.SaveConfig)
+	}
+	if ctx.Flags.SaveProfile != nil {
+		configPath := config.DefaultPath()
+		if ctx.Flags.Config != nil {
+			configPath = *ctx.Flags.Config
+		}
+		overrideConfig := ""
+		if file, err := config.Load(configPath); err == nil {
+			if profile, err := file.Profile(*ctx.Flags.SaveProfile); err == nil && profile != nil {
+				if value, ok := profile["kata-override-config"]; ok {
+					overrideConfig = fmt.Sprint(value)
+				}
+			}
+		}
+		overrideConfig, err = report.OverrideConfig(overrideConfig)
+		if err != nil {
+			return err
+		}
+		err = config.SetProfileValue(configPath, *ctx.Flags.SaveProfile, "kata-override-config", overrideConfig)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctx.Stderr, "Saved kata-override-config: %s into the profile %s\n", overrideConfig, *ctx.Flags.SaveProfile)
+	}
+	return nil
+}
+
+func runListPlatforms(ctx *CommandContext) error {
+	platforms, err := ctx.Client.ListPlatforms()
+	if err != nil {
+		return err
+	}
+	return WritePlatforms(ctx.Stdout, platforms, ctx.Flags.Output)
+}
+
+func runDescribePlatform(ctx *CommandContext) error {
+	if len(ctx.Flags.Platform) == 0 {
+		return NewUsageError("the required flag `-p, --platform' was not specified")
+	}
+	info, err := ctx.Client.DescribePlatform(ctx.Flags.Platform)
+	if err != nil {
+		return err
+	}
+	return WritePlatform(ctx.Stdout, info, ctx.Flags.Output)
+}
+
+func runCheckConfig(ctx *CommandContext) error {
+	if ctx.Flags.KataLocalConfig == nil {
+		return NewUsageError("the required flag `--kata-local-config' was not specified")
+	}
+	result, err := CheckConfig(*ctx.Flags.KataLocalConfig, ctx.Flags.KataOverrideConfig)
+	if err != nil {
+		return err
+	}
+	err = WriteCheckConfigResult(ctx.Stdout, result, ctx.Flags.Output)
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errors.New("config_check_failed")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/kinfkong/ikatago-client/model"
+)
+
+func TestCheckLoginOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts model.AllOpts
+		ok   bool
+	}{
+		{name: "all set", opts: model.AllOpts{Platform: "colab", Username: "foo", Password: "x"}, ok: true},
+		{name: "no platform", opts: model.AllOpts{Username: "foo", Password: "x"}},
+		{name: "no username", opts: model.AllOpts{Platform: "colab", Password: "x"}},
+		{name: "no password", opts: model.AllOpts{Platform: "colab", Username: "foo"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckLoginOptions(&test.opts)
+			if test.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.ok && CommandExitCode(err) != ExitCodeUsage {
+				t.Errorf("got %v, want a usage error", err)
+			}
+		})
+	}
+}
+
+func TestLoginCommands(t *testing.T) {
+	for _, name := range []string{"run-katago", "preload-katago", "query-server", "view-config"} {
+		if !FindCommand(name).Login {
+			t.Errorf("%s should require the login flags", name)
+		}
+	}
+	for _, name := range []string{"help", "list-platforms", "describe-platform", "check-config"} {
+		if FindCommand(name).Login {
+			t.Errorf("%s should not require the login flags", name)
+		}
+	}
+}
+
+func TestCommandExitCodeOfLocalKatago(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no signals on windows")
+	}
+	tests := []struct {
+		name     string
+		script   string
+		status   int
+		signal   string
+		exitCode int
+	}{
+		{name: "exit", script: "exit 3", status: 3, exitCode: ExitCodeRemote},
+		{name: "killed", script: "kill -KILL $$", status: 128 + 9, signal: "KILL", exitCode: ExitCodeRemote},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := exec.Command("sh", "-c", test.script).Run()
+			if status := ExitCodeOf(err); status != test.status {
+				t.Errorf("exit status: got %d, want %d", status, test.status)
+			}
+			if signal := ExitSignalOf(err); signal != test.signal {
+				t.Errorf("signal: got %q, want %q", signal, test.signal)
+			}
+			if exitCode := CommandExitCode(err); exitCode != test.exitCode {
+				t.Errorf("exit code: got %d, want %d", exitCode, test.exitCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/model"
+	"github.com/kinfkong/ikatago-client/platform"
+	"github.com/kinfkong/ikatago-client/utils"
+)
+
+// discoveryRequest represents the body of the discovery request to the getPostUrl of the platform
+type discoveryRequest struct {
+	Username  string `json:"username"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	Proof     string `json:"proof"`
+}
+
+// getSSHOptionsByPost gets the ssh info by posting the username with a proof to the getPostUrl of the platform,
+// so that the username is not in a public url and the host is only returned to the user who knows the secret.
+// it returns the http status code, 0 if the request cannot be sent.
+func (client *Client) getSSHOptionsByPost(p *platform.Platform) (*model.SSHOptions, int, error) {
+	nonceBytes := make([]byte, 16)
+	_, err := rand.Read(nonceBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+	request := discoveryRequest{
+		Username:  client.Options.Username,
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonceBytes),
+	}
+	request.Proof = discoveryProof(client.discoveryKey(), request.Username, request.Timestamp, request.Nonce)
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	statusCode, response, err := utils.DoHTTPRequestWithStatus("POST", *p.Http.GetPostUrl, headers, body)
+	if err != nil {
+		return nil, statusCode, err
+	}
+	sshoptions := model.SSHOptions{}
+	err = json.Unmarshal([]byte(response), &sshoptions)
+	if err != nil {
+		log.Printf("ERROR failed parsing json of the discovery response\n")
+		return nil, statusCode, err
+	}
+	return &sshoptions, statusCode, nil
+}
+
+// discoveryKey returns the key of the discovery proof, it is the token if provided, otherwise the sha256 of
+// the password, so that the password itself is never sent
+func (client *Client) discoveryKey() []byte {
+	if client.Options.Token != nil && len(*client.Options.Token) > 0 {
+		return []byte(*client.Options.Token)
+	}
+	passwordHash := sha256.Sum256([]byte(client.Options.Password))
+	return passwordHash[:]
+}
+
+// discoveryProof returns the proof of the discovery request, the hex of HMAC-SHA256(key, "<username>\n<timestamp>\n<nonce>").
+// the server computes it with the same key to check the request, and rejects the old timestamps and the reused nonces.
+func discoveryProof(key []byte, username string, timestamp int64, nonce string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fmt.Sprintf("%s\n%d\n%s", username, timestamp, nonce)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isDiscoveryEndpointMissing checks if the getPostUrl does not exist or cannot be reached,
+// only then the public ssh info is used instead
+func isDiscoveryEndpointMissing(statusCode int, err error) bool {
+	if err == nil {
+		return false
+	}
+	if statusCode == 0 {
+		return err.Error() == "failed_do_request"
+	}
+	return statusCode == http.StatusNotFound || statusCode == http.StatusMethodNotAllowed || statusCode == http.StatusNotImplemented
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kinfkong/ikatago-client/platform"
+)
+
+// newDiscoveryServer returns the getPostUrl which checks the proof with the sha256 of the password
+func newDiscoveryServer(t *testing.T, password string) string {
+	passwordHash := sha256.Sum256([]byte(password))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["password"]; ok {
+			t.Error("the password is sent to the discovery")
+		}
+		request := discoveryRequest{}
+		raw, _ := json.Marshal(body)
+		json.Unmarshal(raw, &request)
+		if len(request.Nonce) == 0 || request.Proof != discoveryProof(passwordHash[:], request.Username, request.Timestamp, request.Nonce) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"host": "10.0.0.1", "port": 2222, "user": request.Username})
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestDiscoveryByPost(t *testing.T) {
+	getPostURL := newDiscoveryServer(t, "secret")
+	p := &platform.Platform{Name: "fake", Http: &platform.Http{GetPostUrl: &getPostURL}}
+
+	client, _ := NewClient(Options{Username: "foo", Password: "secret"})
+	sshoptions, err := client.getSSHOptions(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sshoptions.Host != "10.0.0.1" || sshoptions.Port != 2222 || sshoptions.Password != "secret" {
+		t.Errorf("got %+v", sshoptions)
+	}
+
+	client, _ = NewClient(Options{Username: "foo", Password: "wrong"})
+	_, err = client.getSSHOptions(p)
+	if err == nil || err.Error() != "discovery_unauthorized" {
+		t.Errorf("wrong password: got %v, want discovery_unauthorized", err)
+	}
+}
+
+func TestDiscoveryProof(t *testing.T) {
+	proof := discoveryProof([]byte("key"), "foo", 1700000000, "abc")
+	if len(proof) != 64 || strings.Trim(proof, "0123456789abcdef") != "" {
+		t.Errorf("the proof is not the hex of sha256: %q", proof)
+	}
+	for _, other := range []string{
+		discoveryProof([]byte("key"), "bar", 1700000000, "abc"),
+		discoveryProof([]byte("key"), "foo", 1700000001, "abc"),
+		discoveryProof([]byte("key"), "foo", 1700000000, "abd"),
+		discoveryProof([]byte("other"), "foo", 1700000000, "abc"),
+	} {
+		if other == proof {
+			t.Errorf("the proof does not depend on all the inputs: %q", other)
+		}
+	}
+}
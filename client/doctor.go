@@ -0,0 +1,234 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/katassh"
+	"github.com/kinfkong/ikatago-client/model"
+	"github.com/kinfkong/ikatago-client/platform"
+)
+
+const (
+	// DoctorStepWorld fetches the world
+	DoctorStepWorld = "world"
+	// DoctorStepPlatform looks up the platform in the world
+	DoctorStepPlatform = "platform"
+	// DoctorStepSSHInfo fetches the ssh info of the user
+	DoctorStepSSHInfo = "ssh-info"
+	// DoctorStepDNS resolves the host of the server
+	DoctorStepDNS = "dns"
+	// DoctorStepTCP connects to the port of the server
+	DoctorStepTCP = "tcp"
+	// DoctorStepSSHHandshake does the ssh handshake
+	DoctorStepSSHHandshake = "ssh-handshake"
+	// DoctorStepSSHAuth authenticates the user
+	DoctorStepSSHAuth = "ssh-auth"
+	// DoctorStepRemoteCommand runs query-server on the server
+	DoctorStepRemoteCommand = "remote-command"
+	// DoctorStepConfigUpload uploads the local katago config
+	DoctorStepConfigUpload = "config-upload"
+	// DoctorStepGTP starts katago and sends the gtp version command
+	DoctorStepGTP = "gtp"
+)
+
+// doctorGTPTimeout is how long the doctor waits for the gtp response, including loading the model
+const doctorGTPTimeout = 3 * time.Minute
+
+// DoctorStep represents the result of a diagnostic step
+type DoctorStep struct {
+	Name           string `json:"name"`
+	OK             bool   `json:"ok"`
+	Skipped        bool   `json:"skipped,omitempty"`
+	DurationMillis int64  `json:"durationMillis"`
+	Detail         string `json:"detail,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Advice         string `json:"advice,omitempty"`
+}
+
+// DoctorReport represents the result of all the diagnostic steps
+type DoctorReport struct {
+	OK    bool         `json:"ok"`
+	Steps []DoctorStep `json:"steps"`
+}
+
+// doctor runs the diagnostic steps in order, the steps after the first failure are skipped
+type doctor struct {
+	report *DoctorReport
+	failed bool
+}
+
+// run runs the step, check returns the detail of the step
+func (d *doctor) run(name string, advice string, check func() (string, error)) {
+	step := DoctorStep{Name: name}
+	if d.failed {
+		step.Skipped = true
+		d.report.Steps = append(d.report.Steps, step)
+		return
+	}
+	start := time.Now()
+	detail, err := check()
+	step.DurationMillis = time.Since(start).Milliseconds()
+	step.Detail = detail
+	if err != nil {
+		step.Error = err.Error()
+		step.Advice = advice
+		d.failed = true
+	} else {
+		step.OK = true
+	}
+	d.report.Steps = append(d.report.Steps, step)
+}
+
+// skip adds the step which is not needed
+func (d *doctor) skip(name string, detail string) {
+	d.report.Steps = append(d.report.Steps, DoctorStep{Name: name, Skipped: true, Detail: detail})
+}
+
+// Doctor checks each step of connecting to the engine, and reports the timings and the advices
+func (client *Client) Doctor(options RunKatagoOptions, subCommands []string) *DoctorReport {
+	d := &doctor{report: &DoctorReport{Steps: make([]DoctorStep, 0)}}
+	var world *platform.World
+	var p *platform.Platform
+	var sshOptions *model.SSHOptions
+	var addresses []string
+
+	d.run(DoctorStepWorld, "check the internet connection and the --world url", func() (string, error) {
+		var err error
+		world, err = FetchWorld(client.Options.World)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d platforms", len(world.Platforms)), nil
+	})
+	d.run(DoctorStepPlatform, "check the --platform name with the list-platforms command", func() (string, error) {
+		p = world.FindPlatform(client.Options.Platform)
+		if p == nil {
+			return "", errors.New("platform_not_found")
+		}
+		return fmt.Sprintf("discovery: %s", p.DiscoveryType()), nil
+	})
+	d.run(DoctorStepSSHInfo, "check the --username, and make sure the server is started on the platform", func() (string, error) {
+		var err error
+		sshOptions, err = client.getSSHOptions(p)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s@%s:%d", sshOptions.User, sshOptions.Host, sshOptions.Port), nil
+	})
+	d.run(DoctorStepDNS, "check the dns settings, or try another network", func() (string, error) {
+		var err error
+		addresses, err = net.LookupHost(sshOptions.Host)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(addresses, ", "), nil
+	})
+	d.run(DoctorStepTCP, "the server is not reachable, it may be stopped, or blocked by a firewall or proxy", func() (string, error) {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(sshOptions.Host, strconv.Itoa(sshOptions.Port)), 30*time.Second)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.RemoteAddr().String(), nil
+	})
+	var handshake *katassh.HandshakeResult
+	d.run(DoctorStepSSHHandshake, "the server does not speak ssh, the port may be taken by a proxy", func() (string, error) {
+		handshake = katassh.CheckHandshake(*sshOptions)
+		return "", handshake.HandshakeErr
+	})
+	d.run(DoctorStepSSHAuth, "check the --password, it is case sensitive", func() (string, error) {
+		return handshake.ServerVersion, handshake.AuthErr
+	})
+	if handshake != nil {
+		// correct the timings with the ones measured by the handshake
+		steps := d.report.Steps
+		steps[len(steps)-2].DurationMillis = handshake.Handshake.Milliseconds()
+		steps[len(steps)-1].DurationMillis = handshake.Auth.Milliseconds()
+	}
+	if !d.failed {
+		client.initLock.Lock()
+		client.sshOptions = *sshOptions
+		client.init = true
+		client.initLock.Unlock()
+	}
+	d.run(DoctorStepRemoteCommand, "the server does not support the ikatago commands, it may need to be upgraded", func() (string, error) {
+		buf := bytes.NewBuffer(nil)
+		err := client.QueryServer(buf)
+		if err != nil {
+			return "", err
+		}
+		info := ParseServerInfo(buf.String())
+		return fmt.Sprintf("%d weights, %d gpu types", len(info.Weights), len(info.GpuTypes)), nil
+	})
+	if options.KataLocalConfig == nil {
+		d.skip(DoctorStepConfigUpload, "no --kata-local-config")
+	} else {
+		d.run(DoctorStepConfigUpload, "check the config with the check-config command", func() (string, error) {
+			return client.uploadLocalConfig(options, ioutil.Discard)
+		})
+	}
+	d.run(DoctorStepGTP, "katago cannot start, check the --kata-weight, --kata-config and --kata-override-config with query-server and view-config", func() (string, error) {
+		return client.checkGTP(options, subCommands)
+	})
+	d.report.OK = !d.failed
+	return d.report
+}
+
+// checkGTP starts katago and sends the gtp version command
+func (client *Client) checkGTP(options RunKatagoOptions, subCommands []string) (string, error) {
+	probe, err := client.startProbe(options, subCommands)
+	if err != nil {
+		return "", err
+	}
+	defer probe.close()
+	version, err := probe.command("version", doctorGTPTimeout)
+	if err != nil {
+		return probe.lastLog(), err
+	}
+	return "katago " + version, nil
+}
+
+// WriteDoctorReport writes the report to the writer in the given output format
+func WriteDoctorReport(w io.Writer, report *DoctorReport, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tRESULT\tTIME\tDETAIL")
+	for _, step := range report.Steps {
+		result := "ok"
+		if step.Skipped {
+			result = "skipped"
+		} else if !step.OK {
+			result = "FAILED"
+		}
+		detail := step.Detail
+		if len(step.Error) > 0 {
+			detail = strings.TrimSpace(step.Error + " " + detail)
+		}
+		duration := ""
+		if !step.Skipped {
+			duration = fmt.Sprintf("%dms", step.DurationMillis)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", step.Name, result, duration, detail)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	for _, step := range report.Steps {
+		if len(step.Advice) > 0 {
+			fmt.Fprintf(w, "\n%s failed: %s\n", step.Name, step.Advice)
+		}
+	}
+	return nil
+}
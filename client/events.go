@@ -0,0 +1,193 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// EventConnecting fires before the ssh info is discovered
+	EventConnecting = "connecting"
+	// EventConnected fires when the ssh connection is established
+	EventConnected = "connected"
+	// EventUploadingConfig fires before the local config is uploaded
+	EventUploadingConfig = "uploading-config"
+	// EventConfigUploaded fires when the local config is uploaded
+	EventConfigUploaded = "config-uploaded"
+	// EventEngineStarted fires when the remote engine command is started
+	EventEngineStarted = "engine-started"
+	// EventExited fires when the remote engine exits, with the exit code
+	EventExited = "exited"
+	// EventDisconnected fires when the connection is lost or the session is stopped
+	EventDisconnected = "disconnected"
+	// EventFailed fires when the session cannot be started
+	EventFailed = "failed"
+)
+
+const (
+	// ErrorClassConfig means the local config or options are invalid
+	ErrorClassConfig = "config"
+	// ErrorClassDiscovery means the world, platform or ssh info cannot be fetched
+	ErrorClassDiscovery = "discovery"
+	// ErrorClassAuth means the server refuses the username or password
+	ErrorClassAuth = "auth"
+	// ErrorClassConnection means the server cannot be reached or the connection is lost
+	ErrorClassConnection = "connection"
+	// ErrorClassRemote means the remote command, or the fallback katago, exits with error
+	ErrorClassRemote = "remote"
+	// ErrorClassUnknown means the error cannot be classified
+	ErrorClassUnknown = "unknown"
+)
+
+// Event represents a lifecycle event of the session
+type Event struct {
+	Type       string
+	Err        error
+	ErrorClass string
+	ExitCode   int
+}
+
+var errorClasses = map[string]string{
+	"invalid_config":          ErrorClassConfig,
+	"invalid_override_config": ErrorClassConfig,
+	"file_not_found":          ErrorClassConfig,
+	"invalid_file_extension":  ErrorClassConfig,
+	"file_too_large":          ErrorClassConfig,
+	"io_error":                ErrorClassConfig,
+	"checksum_mismatch":       ErrorClassConnection,
+	"checksum_not_confirmed":  ErrorClassConnection,
+	"platform_not_found":      ErrorClassDiscovery,
+	"discovery_unavailable":   ErrorClassDiscovery,
+	"discovery_unauthorized":  ErrorClassAuth,
+	"preload_not_found":       ErrorClassConfig,
+	"preload_not_supported":   ErrorClassConfig,
+	"failed_do_request":       ErrorClassDiscovery,
+	"failed_read_body":        ErrorClassDiscovery,
+	"invalid_status":          ErrorClassDiscovery,
+}
+
+// ClassifyError returns the class of the error, like auth, connection
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if class, ok := errorClasses[err.Error()]; ok {
+		return class
+	}
+	var exitError *ssh.ExitError
+	var exitMissingError *ssh.ExitMissingError
+	var localExitError *exec.ExitError
+	var netError net.Error
+	if errors.As(err, &exitError) || errors.As(err, &exitMissingError) || errors.As(err, &localExitError) {
+		return ErrorClassRemote
+	}
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return ErrorClassAuth
+	}
+	var pathError *fs.PathError
+	if errors.As(err, &pathError) {
+		// the local files, like the config file, cannot be read
+		return ErrorClassConfig
+	}
+	if errors.As(err, &netError) || errors.Is(err, io.EOF) || strings.HasPrefix(err.Error(), "ssh: ") {
+		return ErrorClassConnection
+	}
+	return ErrorClassUnknown
+}
+
+// ExitCodeOf returns the exit code of the remote command or the local fallback katago. it is 0 if err is nil,
+// and -1 if the command did not exit by itself, like the connection is lost.
+// it is 128 + the signal number if the command is killed by a signal.
+func ExitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitError *ssh.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitStatus()
+	}
+	var localExitError *exec.ExitError
+	if errors.As(err, &localExitError) {
+		if signal, ok := localSignalOf(localExitError); ok {
+			return 128 + int(signal)
+		}
+		return localExitError.ExitCode()
+	}
+	return -1
+}
+
+// ExitSignalOf returns the name of the signal which killed the remote command or the local fallback katago, like KILL.
+// it is empty if not killed by a signal.
+func ExitSignalOf(err error) string {
+	var exitError *ssh.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.Signal()
+	}
+	var localExitError *exec.ExitError
+	if errors.As(err, &localExitError) {
+		if signal, ok := localSignalOf(localExitError); ok {
+			if name, ok := signalNames[signal]; ok {
+				return name
+			}
+			return strconv.Itoa(int(signal))
+		}
+	}
+	return ""
+}
+
+// signalNames are the names of the signals like in the exit-signal of ssh
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "ABRT",
+	syscall.SIGALRM: "ALRM",
+	syscall.SIGBUS:  "BUS",
+	syscall.SIGFPE:  "FPE",
+	syscall.SIGHUP:  "HUP",
+	syscall.SIGILL:  "ILL",
+	syscall.SIGINT:  "INT",
+	syscall.SIGKILL: "KILL",
+	syscall.SIGPIPE: "PIPE",
+	syscall.SIGQUIT: "QUIT",
+	syscall.SIGSEGV: "SEGV",
+	syscall.SIGTERM: "TERM",
+}
+
+// localSignalOf returns the signal which killed the local process, ExitCode of exec.ExitError is -1 in this case
+func localSignalOf(exitError *exec.ExitError) (syscall.Signal, bool) {
+	status, ok := exitError.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	})
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+	return status.Signal(), true
+}
+
+func notify(onEvent func(event Event), eventType string, err error) {
+	eventsTotal.Inc(eventType)
+	if err != nil && (eventType == EventFailed || eventType == EventDisconnected) {
+		errorsTotal.Inc(ClassifyError(err))
+	}
+	if onEvent == nil {
+		return
+	}
+	event := Event{
+		Type: eventType,
+		Err:  err,
+	}
+	if err != nil {
+		event.ErrorClass = ClassifyError(err)
+	}
+	if eventType == EventExited {
+		event.ExitCode = ExitCodeOf(err)
+	}
+	onEvent(event)
+}
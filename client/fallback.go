@@ -0,0 +1,368 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// stateCommands are the gtp commands which change the state of the engine, they are replayed on the local katago
+var stateCommands = map[string]bool{
+	"boardsize":           true,
+	"clear_board":         true,
+	"komi":                true,
+	"play":                true,
+	"undo":                true,
+	"fixed_handicap":      true,
+	"place_free_handicap": true,
+	"set_free_handicap":   true,
+	"set_position":        true,
+	"loadsgf":             true,
+	"kata-set-rules":      true,
+	"kata-set-rule":       true,
+	"kata-set-param":      true,
+	"time_settings":       true,
+	"kata-time_settings":  true,
+	"kgs-time_settings":   true,
+}
+
+// positionCommands are the state commands which are obsolete after clear_board or boardsize
+var positionCommands = map[string]bool{
+	"play":                true,
+	"undo":                true,
+	"fixed_handicap":      true,
+	"place_free_handicap": true,
+	"set_free_handicap":   true,
+	"set_position":        true,
+	"loadsgf":             true,
+}
+
+type gtpCommand struct {
+	line   string
+	hidden bool
+	// resent means the status line of the command has been shown by the previous engine
+	resent bool
+}
+
+// gtpProxy forwards the gtp commands to the current engine, and keeps the state commands and the unanswered
+// commands so that they can be sent again to another engine
+type gtpProxy struct {
+	// writeLock keeps the order of the writes to the engine. lock is not held while writing, since the engine
+	// may not read its input until its output is received by Write, which needs lock.
+	writeLock    sync.Mutex
+	lock         sync.Mutex
+	engine       io.Writer
+	history      []string
+	pending      []gtpCommand
+	outputWriter io.Writer
+	quit         bool
+
+	outputLock sync.Mutex
+	partial    []byte
+	current    *gtpCommand
+	response   []string
+}
+
+// runKatagoWithFallback runs katago on the remote server, and switches to the local katago if the remote one fails
+func (client *Client) runKatagoWithFallback(options RunKatagoOptions, subCommands []string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, onReady func()) (*SessionResult, error) {
+	if options.UseRawData {
+		return nil, errors.New("fallback_requires_decoded_output")
+	}
+	proxy := &gtpProxy{outputWriter: outputWriter}
+	remoteReader, remoteWriter := io.Pipe()
+	proxy.engine = remoteWriter
+
+	var readyOnce sync.Once
+	ready := func() {
+		readyOnce.Do(func() {
+			if onReady != nil {
+				onReady()
+			}
+		})
+	}
+	remoteOptions := options
+	remoteOptions.FallbackKatago = nil
+	remote, err := client.runKatagoCommand("run-katago", remoteOptions, subCommands, remoteReader, proxy, stderrWriter, ready)
+	if err != nil {
+		log.Printf("ERROR failed to start the remote katago: %v\n", err)
+	}
+
+	var lock sync.Mutex
+	var local *exec.Cmd
+	// stopped means the session is stopped by the user, the remote katago ends because of it, not a failure
+	stopped := false
+	result := &SessionResult{
+		done: make(chan struct{}),
+	}
+	result.stop = func() {
+		lock.Lock()
+		stopped = true
+		if local != nil && local.Process != nil {
+			local.Process.Kill()
+		}
+		lock.Unlock()
+		if remote != nil {
+			remote.Stop()
+		}
+	}
+	if options.Context != nil {
+		go func() {
+			select {
+			case <-options.Context.Done():
+				result.Stop()
+			case <-result.done:
+			}
+		}()
+	}
+	go proxy.pump(inputReader)
+
+	result.wg.Add(1)
+	go func() {
+		defer result.wg.Done()
+		defer close(result.done)
+		defer func() {
+			result.ExitStatus = ExitCodeOf(result.Err)
+			result.Signal = ExitSignalOf(result.Err)
+		}()
+		remoteErr := err
+		if remote != nil {
+			remote.Wait()
+			remoteErr = remote.Err
+		}
+		remoteReader.CloseWithError(errors.New("remote_katago_exited"))
+		lock.Lock()
+		isStopped := stopped || (options.Context != nil && options.Context.Err() != nil)
+		lock.Unlock()
+		if proxy.hasQuit() || isStopped {
+			// the user has quit or stopped the session, it is not a failure to fall back from
+			result.Err = remoteErr
+			return
+		}
+		fmt.Fprintf(stderrWriter, "NOTICE the remote katago failed (%v), switching to the local katago: %s\n", remoteErr, *options.FallbackKatago)
+		cmd := localKatagoCommand(options, subCommands)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			result.Err = err
+			return
+		}
+		cmd.Stdout = proxy
+		cmd.Stderr = stderrWriter
+		lock.Lock()
+		if stopped {
+			lock.Unlock()
+			result.Err = remoteErr
+			return
+		}
+		local = cmd
+		err = cmd.Start()
+		lock.Unlock()
+		if err != nil {
+			log.Printf("ERROR failed to start the local katago: %v\n", err)
+			result.Err = err
+			return
+		}
+		ready()
+		proxy.switchTo(stdin)
+		result.Err = cmd.Wait()
+	}()
+	return result, nil
+}
+
+// localKatagoCommand builds the command of the local katago with the same subcommands and override config
+func localKatagoCommand(options RunKatagoOptions, subCommands []string) *exec.Cmd {
+	args := append([]string{}, subCommands...)
+	if len(args) == 0 {
+		args = append(args, "gtp")
+	}
+	if options.FallbackModel != nil {
+		args = append(args, "-model", *options.FallbackModel)
+	}
+	if options.FallbackConfig != nil {
+		args = append(args, "-config", *options.FallbackConfig)
+	} else if options.KataLocalConfig != nil {
+		args = append(args, "-config", *options.KataLocalConfig)
+	}
+	if options.KataOverrideConfig != nil {
+		args = append(args, "-override-config", *options.KataOverrideConfig)
+	}
+	return exec.Command(*options.FallbackKatago, args...)
+}
+
+// pump reads the gtp commands from the input, and sends them to the current engine
+func (proxy *gtpProxy) pump(inputReader io.Reader) {
+	reader := bufio.NewReader(inputReader)
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			proxy.send(line)
+		}
+		if err != nil {
+			proxy.writeLock.Lock()
+			proxy.lock.Lock()
+			proxy.quit = true
+			engine := proxy.engine
+			proxy.lock.Unlock()
+			if closer, ok := engine.(io.Closer); ok {
+				closer.Close()
+			}
+			proxy.writeLock.Unlock()
+			return
+		}
+	}
+}
+
+func (proxy *gtpProxy) send(line string) {
+	proxy.writeLock.Lock()
+	defer proxy.writeLock.Unlock()
+	proxy.lock.Lock()
+	if GTPCommandName(line) == "quit" {
+		proxy.quit = true
+	}
+	proxy.pending = append(proxy.pending, gtpCommand{line: line})
+	engine := proxy.engine
+	proxy.lock.Unlock()
+	// the command is sent again to the next engine if it fails here
+	io.WriteString(engine, line+"\n")
+}
+
+func (proxy *gtpProxy) hasQuit() bool {
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	return proxy.quit
+}
+
+// switchTo replays the state commands on the new engine without showing their responses, and sends the
+// unanswered commands again, including the one whose response was cut off
+func (proxy *gtpProxy) switchTo(engine io.WriteCloser) {
+	proxy.outputLock.Lock()
+	current := proxy.current
+	if current != nil && len(proxy.response) > 0 {
+		current.resent = true
+	}
+	proxy.partial = nil
+	proxy.current = nil
+	proxy.response = nil
+	proxy.outputLock.Unlock()
+	proxy.writeLock.Lock()
+	defer proxy.writeLock.Unlock()
+	proxy.lock.Lock()
+	unanswered := proxy.pending
+	if current != nil && len(current.line) > 0 {
+		unanswered = append([]gtpCommand{*current}, unanswered...)
+	}
+	proxy.pending = make([]gtpCommand, 0, len(proxy.history)+len(unanswered))
+	proxy.engine = engine
+	for _, line := range proxy.history {
+		proxy.pending = append(proxy.pending, gtpCommand{line: line, hidden: true})
+	}
+	proxy.history = nil
+	proxy.pending = append(proxy.pending, unanswered...)
+	commands := append([]gtpCommand{}, proxy.pending...)
+	quit := proxy.quit
+	proxy.lock.Unlock()
+
+	for _, command := range commands {
+		io.WriteString(engine, command.line+"\n")
+	}
+	if quit {
+		engine.Close()
+	}
+}
+
+// Write receives the output of the engine, and forwards it line by line
+func (proxy *gtpProxy) Write(p []byte) (int, error) {
+	proxy.outputLock.Lock()
+	defer proxy.outputLock.Unlock()
+	proxy.partial = append(proxy.partial, p...)
+	for {
+		index := strings.IndexByte(string(proxy.partial), '\n')
+		if index < 0 {
+			break
+		}
+		line := string(proxy.partial[:index+1])
+		proxy.partial = proxy.partial[index+1:]
+		proxy.onLine(line)
+	}
+	return len(p), nil
+}
+
+func (proxy *gtpProxy) onLine(line string) {
+	trimmed := strings.TrimSpace(line)
+	if proxy.current == nil {
+		if len(trimmed) == 0 {
+			proxy.outputWriter.Write([]byte(line))
+			return
+		}
+		proxy.lock.Lock()
+		if len(proxy.pending) > 0 {
+			command := proxy.pending[0]
+			proxy.pending = proxy.pending[1:]
+			proxy.current = &command
+		} else {
+			proxy.current = &gtpCommand{}
+		}
+		proxy.lock.Unlock()
+	}
+	if !proxy.current.hidden && !(proxy.current.resent && len(proxy.response) == 0) {
+		proxy.outputWriter.Write([]byte(line))
+	}
+	if len(trimmed) > 0 {
+		// only the status line and the move of genmove are needed by finish, the analysis lines are dropped
+		// so that a long analysis does not keep growing the response
+		if len(proxy.response) == 0 || strings.HasPrefix(trimmed, "play ") {
+			proxy.response = append(proxy.response, trimmed)
+		}
+		return
+	}
+	proxy.finish(*proxy.current, proxy.response)
+	proxy.current = nil
+	proxy.response = nil
+}
+
+// finish keeps the state command if it succeeded
+func (proxy *gtpProxy) finish(command gtpCommand, response []string) {
+	if len(response) == 0 || !strings.HasPrefix(response[0], "=") {
+		return
+	}
+	fields := strings.Fields(command.line)
+	name := GTPCommandName(command.line)
+	if len(fields) > 0 && name != fields[0] {
+		// without the id
+		fields = fields[1:]
+	}
+	line := strings.Join(fields, " ")
+	if strings.Contains(name, "genmove") && len(fields) > 1 {
+		move := strings.TrimSpace(strings.TrimLeft(response[0], "=0123456789"))
+		for _, l := range response {
+			if strings.HasPrefix(l, "play ") {
+				move = strings.TrimSpace(strings.TrimPrefix(l, "play "))
+			}
+		}
+		if len(move) == 0 || strings.EqualFold(move, "resign") {
+			return
+		}
+		name = "play"
+		line = "play " + fields[1] + " " + move
+	}
+	if !stateCommands[name] {
+		return
+	}
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	if name == "clear_board" || name == "boardsize" {
+		history := make([]string, 0, len(proxy.history))
+		for _, l := range proxy.history {
+			if !positionCommands[GTPCommandName(l)] {
+				history = append(history, l)
+			}
+		}
+		proxy.history = history
+	}
+	proxy.history = append(proxy.history, line)
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoEngine answers every command synchronously in Write, like an engine which does not read its input
+// until its output is received
+type echoEngine struct {
+	proxy    *gtpProxy
+	lock     sync.Mutex
+	commands []string
+	closed   bool
+}
+
+func (engine *echoEngine) Write(p []byte) (int, error) {
+	engine.lock.Lock()
+	engine.commands = append(engine.commands, string(p))
+	engine.lock.Unlock()
+	engine.proxy.Write([]byte("= \n\n"))
+	return len(p), nil
+}
+
+func (engine *echoEngine) Close() error {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	engine.closed = true
+	return nil
+}
+
+func TestGTPProxySwitch(t *testing.T) {
+	output := &bytes.Buffer{}
+	proxy := &gtpProxy{outputWriter: output}
+	remote := &echoEngine{proxy: proxy}
+	proxy.engine = remote
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proxy.send("komi 7.5")
+		proxy.send("1 play B D4")
+		proxy.send("name")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the proxy is deadlocked by the engine answering in Write")
+	}
+	if want := []string{"komi 7.5", "play B D4"}; !reflect.DeepEqual(proxy.history, want) {
+		t.Errorf("history: got %q, want %q", proxy.history, want)
+	}
+
+	local := &echoEngine{proxy: proxy}
+	proxy.lock.Lock()
+	proxy.quit = true
+	proxy.lock.Unlock()
+	output.Reset()
+	proxy.switchTo(local)
+	if want := []string{"komi 7.5\n", "play B D4\n"}; !reflect.DeepEqual(local.commands, want) {
+		t.Errorf("replayed: got %q, want %q", local.commands, want)
+	}
+	if output.Len() != 0 {
+		t.Errorf("the responses of the replayed commands are shown: %q", output.String())
+	}
+	if !local.closed {
+		t.Error("the new engine is not closed after quit")
+	}
+}
+
+// silentEngine records the commands without answering them
+type silentEngine struct {
+	lock     sync.Mutex
+	commands []string
+}
+
+func (engine *silentEngine) Write(p []byte) (int, error) {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	engine.commands = append(engine.commands, string(p))
+	return len(p), nil
+}
+
+func (engine *silentEngine) Close() error {
+	return nil
+}
+
+func TestGTPProxySwitchInFlight(t *testing.T) {
+	output := &bytes.Buffer{}
+	proxy := &gtpProxy{outputWriter: output}
+	proxy.engine = &silentEngine{}
+	proxy.send("komi 7.5")
+	proxy.Write([]byte("= \n\n"))
+	proxy.send("kata-genmove_analyze B 50")
+	proxy.send("name")
+	// the remote dies in the middle of the analysis
+	proxy.Write([]byte("=\n"))
+	for i := 0; i < 1000; i++ {
+		proxy.Write([]byte("info move D4 visits 10 winrate 0.5\n"))
+	}
+	if len(proxy.response) != 1 {
+		t.Errorf("the analysis lines are kept in the response: %d lines", len(proxy.response))
+	}
+
+	local := &silentEngine{}
+	output.Reset()
+	proxy.switchTo(local)
+	want := []string{"komi 7.5\n", "kata-genmove_analyze B 50\n", "name\n"}
+	if !reflect.DeepEqual(local.commands, want) {
+		t.Errorf("sent to the new engine: got %q, want %q", local.commands, want)
+	}
+	proxy.Write([]byte("= \n\n=\ninfo move Q16 visits 5\nplay Q16\n\n= KataGo\n\n"))
+	// the status line of the genmove has been shown by the remote engine
+	if want := "info move Q16 visits 5\nplay Q16\n\n= KataGo\n\n"; output.String() != want {
+		t.Errorf("output: got %q, want %q", output.String(), want)
+	}
+	if want := []string{"komi 7.5", "play B Q16"}; !reflect.DeepEqual(proxy.history, want) {
+		t.Errorf("history: got %q, want %q", proxy.history, want)
+	}
+}
@@ -0,0 +1,15 @@
+package client
+
+import "strings"
+
+// GTPCommandName returns the gtp command name of the line, without the optional id
+func GTPCommandName(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) > 1 && strings.Trim(fields[0], "0123456789") == "" {
+		return fields[1]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
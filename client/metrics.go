@@ -0,0 +1,145 @@
+package client
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/metrics"
+)
+
+var (
+	sessionsTotal  = metrics.NewCounterVec("ikatago_sessions_total", "The number of katago sessions by command.", "command")
+	sessionsActive = metrics.NewGaugeVec("ikatago_sessions_active", "The number of running katago sessions.")
+	eventsTotal    = metrics.NewCounterVec("ikatago_session_events_total", "The number of lifecycle events of the sessions by type.", "type")
+	errorsTotal    = metrics.NewCounterVec("ikatago_errors_total", "The number of failed or disconnected sessions by error class.", "class")
+	gtpLatency     = metrics.NewHistogramVec("ikatago_gtp_command_duration_seconds", "The time from sending a gtp command to the start of its response.", nil, "command")
+)
+
+// metricGTPCommands are the gtp commands of the gtp protocol, katago and leela zero which are labelled by name in the
+// metrics. the others, like the typos, are labelled as other, so that the number of the series is bounded.
+var metricGTPCommands = map[string]bool{
+	"protocol_version": true, "name": true, "version": true, "known_command": true, "list_commands": true,
+	"quit": true, "boardsize": true, "clear_board": true, "komi": true, "get_komi": true, "play": true,
+	"genmove": true, "genmove_debug": true, "reg_genmove": true, "undo": true, "showboard": true,
+	"fixed_handicap": true, "place_free_handicap": true, "set_free_handicap": true, "set_position": true,
+	"loadsgf": true, "printsgf": true, "final_score": true, "final_status_list": true,
+	"time_settings": true, "time_left": true, "kgs-time_settings": true, "kgs-genmove_cleanup": true, "kgs-rules": true,
+	"stop": true, "cputime": true, "clear_cache": true, "analyze": true, "genmove_analyze": true,
+	"lz-analyze": true, "lz-genmove_analyze": true, "lz-setoption": true,
+	"kata-analyze": true, "kata-genmove_analyze": true, "kata-search": true, "kata-search_analyze": true,
+	"kata-search_cancellable": true, "kata-search_analyze_cancellable": true, "kata-raw-nn": true,
+	"kata-get-rules": true, "kata-set-rules": true, "kata-set-rule": true, "kata-get-param": true,
+	"kata-set-param": true, "kata-list-params": true, "kata-time_settings": true, "kata-list_time_settings": true,
+	"kata-debug-print-tc": true, "kata-benchmark": true, "kata-get-models": true,
+}
+
+// metricGTPCommandName returns the label of the gtp command in the metrics
+func metricGTPCommandName(name string) string {
+	if metricGTPCommands[name] {
+		return name
+	}
+	return "other"
+}
+
+func init() {
+	// show the gauge before the first session
+	sessionsActive.Set(0)
+}
+
+type gtpPending struct {
+	name  string
+	start time.Time
+}
+
+// gtpTimer observes the latency of the gtp commands from the input and the decoded output of a session
+type gtpTimer struct {
+	lock        sync.Mutex
+	pending     []gtpPending
+	partial     string
+	atLineStart bool
+	inResponse  bool
+}
+
+type gtpTimerReader struct {
+	timer  *gtpTimer
+	reader io.Reader
+}
+
+type gtpTimerWriter struct {
+	timer  *gtpTimer
+	writer io.Writer
+}
+
+func newGTPTimer() *gtpTimer {
+	return &gtpTimer{atLineStart: true}
+}
+
+func (r *gtpTimerReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.timer.onInput(p[:n])
+	return n, err
+}
+
+func (w *gtpTimerWriter) Write(p []byte) (int, error) {
+	w.timer.onOutput(p)
+	return w.writer.Write(p)
+}
+
+// onInput remembers the sent commands
+func (timer *gtpTimer) onInput(p []byte) {
+	timer.lock.Lock()
+	defer timer.lock.Unlock()
+	timer.partial += string(p)
+	for {
+		index := strings.IndexByte(timer.partial, '\n')
+		if index < 0 {
+			break
+		}
+		line := strings.TrimSpace(timer.partial[:index])
+		timer.partial = timer.partial[index+1:]
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		timer.pending = append(timer.pending, gtpPending{name: metricGTPCommandName(GTPCommandName(line)), start: time.Now()})
+	}
+}
+
+// onOutput observes the latency when a response starts
+func (timer *gtpTimer) onOutput(p []byte) {
+	timer.lock.Lock()
+	defer timer.lock.Unlock()
+	for _, c := range p {
+		if c == '\n' {
+			if timer.atLineStart {
+				// an empty line ends the response
+				timer.inResponse = false
+			}
+			timer.atLineStart = true
+			continue
+		}
+		if c == '\r' {
+			continue
+		}
+		if timer.atLineStart && !timer.inResponse && (c == '=' || c == '?') && len(timer.pending) > 0 {
+			command := timer.pending[0]
+			timer.pending = timer.pending[1:]
+			gtpLatency.Observe(time.Since(command.start).Seconds(), command.name)
+			timer.inResponse = true
+		}
+		timer.atLineStart = false
+	}
+}
+
+// firstWriteWriter calls onFirstWrite before the first write
+type firstWriteWriter struct {
+	writer       io.Writer
+	once         sync.Once
+	onFirstWrite func()
+}
+
+func (w *firstWriteWriter) Write(p []byte) (int, error) {
+	w.once.Do(w.onFirstWrite)
+	return w.writer.Write(p)
+}
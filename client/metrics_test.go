@@ -0,0 +1,23 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestMetricGTPCommandName(t *testing.T) {
+	tests := map[string]string{
+		"genmove":              "genmove",
+		"kata-analyze":         "kata-analyze",
+		"lz-analyze":           "lz-analyze",
+		"kata-set-param":       "kata-set-param",
+		"genmvoe":              "other",
+		"password123":          "other",
+		"":                     "other",
+		"kata-genmove_analyze": "kata-genmove_analyze",
+	}
+	for name, want := range tests {
+		if got := metricGTPCommandName(name); got != want {
+			t.Errorf("metricGTPCommandName(%q): got %q, want %q", name, got, want)
+		}
+	}
+}
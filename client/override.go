@@ -0,0 +1,168 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/kinfkong/ikatago-client/kataconfig"
+)
+
+// OverrideConfig builds the -override-config option of katago as ordered key value pairs
+type OverrideConfig struct {
+	keys   []string
+	values map[string]string
+}
+
+// NewOverrideConfig creates an empty override config
+func NewOverrideConfig() *OverrideConfig {
+	return &OverrideConfig{
+		keys:   make([]string, 0),
+		values: make(map[string]string),
+	}
+}
+
+// ParseOverrideConfig parses the override config string, like: analysisPVLen=30,numSearchThreads=30.
+// the commas inside the quotes, braces and brackets are part of the value, see kataconfig.SplitOverride.
+func ParseOverrideConfig(overrideConfig string) (*OverrideConfig, error) {
+	config := NewOverrideConfig()
+	for _, pair := range kataconfig.SplitOverride(overrideConfig) {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		idx := strings.Index(pair, "=")
+		if idx <= 0 {
+			log.Printf("ERROR invalid override config: %s\n", pair)
+			return nil, errors.New("invalid_override_config")
+		}
+		config.Set(strings.TrimSpace(pair[:idx]), strings.TrimSpace(pair[idx+1:]))
+	}
+	return config, nil
+}
+
+// Set sets the value of the key, the previous value of the key is replaced
+func (config *OverrideConfig) Set(key string, value string) *OverrideConfig {
+	if _, ok := config.values[key]; !ok {
+		config.keys = append(config.keys, key)
+	}
+	config.values[key] = value
+	return config
+}
+
+// SetInt sets the int value of the key
+func (config *OverrideConfig) SetInt(key string, value int) *OverrideConfig {
+	return config.Set(key, strconv.Itoa(value))
+}
+
+// SetFloat sets the float value of the key
+func (config *OverrideConfig) SetFloat(key string, value float64) *OverrideConfig {
+	return config.Set(key, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// SetBool sets the bool value of the key
+func (config *OverrideConfig) SetBool(key string, value bool) *OverrideConfig {
+	return config.Set(key, strconv.FormatBool(value))
+}
+
+// Get gets the value of the key
+func (config *OverrideConfig) Get(key string) (string, bool) {
+	value, ok := config.values[key]
+	return value, ok
+}
+
+// Delete deletes the key
+func (config *OverrideConfig) Delete(key string) *OverrideConfig {
+	if _, ok := config.values[key]; !ok {
+		return config
+	}
+	delete(config.values, key)
+	for i, k := range config.keys {
+		if k == key {
+			config.keys = append(config.keys[:i], config.keys[i+1:]...)
+			break
+		}
+	}
+	return config
+}
+
+// MaxVisits sets maxVisits
+func (config *OverrideConfig) MaxVisits(maxVisits int) *OverrideConfig {
+	return config.SetInt("maxVisits", maxVisits)
+}
+
+// NumSearchThreads sets numSearchThreads
+func (config *OverrideConfig) NumSearchThreads(numSearchThreads int) *OverrideConfig {
+	return config.SetInt("numSearchThreads", numSearchThreads)
+}
+
+// AnalysisPVLen sets analysisPVLen
+func (config *OverrideConfig) AnalysisPVLen(analysisPVLen int) *OverrideConfig {
+	return config.SetInt("analysisPVLen", analysisPVLen)
+}
+
+// PlayoutDoublingAdvantage sets playoutDoublingAdvantage
+func (config *OverrideConfig) PlayoutDoublingAdvantage(playoutDoublingAdvantage float64) *OverrideConfig {
+	return config.SetFloat("playoutDoublingAdvantage", playoutDoublingAdvantage)
+}
+
+// Rules sets rules, like chinese, japanese
+func (config *OverrideConfig) Rules(rules string) *OverrideConfig {
+	return config.Set("rules", rules)
+}
+
+// Validate validates all the key value pairs, unknown keys are only warned
+func (config *OverrideConfig) Validate() error {
+	valid := true
+	for _, key := range config.keys {
+		value := config.values[key]
+		// the value can have commas only where they are not split, like inside the braces of the json rules
+		if strings.ContainsAny(key, ",= \t\r\n") || strings.ContainsAny(value, "\r\n") || len(kataconfig.SplitOverride(key+"="+value)) != 1 {
+			log.Printf("ERROR invalid characters in override config: %s=%s\n", key, value)
+			valid = false
+			continue
+		}
+		for _, issue := range kataconfig.CheckValue(key, value) {
+			if issue.Severity == kataconfig.SeverityError {
+				log.Printf("ERROR %s\n", issue)
+				valid = false
+			} else {
+				log.Printf("WARNING %s\n", issue)
+			}
+		}
+	}
+	if !valid {
+		return errors.New("invalid_override_config")
+	}
+	return nil
+}
+
+// IsEmpty checks if there is no key value pairs
+func (config *OverrideConfig) IsEmpty() bool {
+	return len(config.keys) == 0
+}
+
+// String serializes the config as the value of -override-config, like: analysisPVLen=30,numSearchThreads=30
+func (config *OverrideConfig) String() string {
+	pairs := make([]string, 0, len(config.keys))
+	for _, key := range config.keys {
+		pairs = append(pairs, key+"="+config.values[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// shellQuote quotes the argument for the remote shell if it contains special characters
+func shellQuote(arg string) string {
+	safe := true
+	for _, c := range arg {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_=,.+:/@%", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe && len(arg) > 0 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
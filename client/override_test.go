@@ -0,0 +1,29 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestParseOverrideConfig(t *testing.T) {
+	config, err := ParseOverrideConfig(`maxVisits=100,rules={"ko":"SIMPLE","scoring":"AREA"},numSearchThreads=8`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := config.Get("rules"); rules != `{"ko":"SIMPLE","scoring":"AREA"}` {
+		t.Errorf("rules: got %q", rules)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if want := `maxVisits=100,rules={"ko":"SIMPLE","scoring":"AREA"},numSearchThreads=8`; config.String() != want {
+		t.Errorf("got %q, want %q", config.String(), want)
+	}
+
+	if _, err := ParseOverrideConfig("maxVisits=100,=8"); err == nil {
+		t.Error("the pair without key: got nil error")
+	}
+	// the comma which would be split is refused
+	if err := NewOverrideConfig().Set("logDir", "a,b").Validate(); err == nil {
+		t.Error("the value with a top level comma: got nil error")
+	}
+}
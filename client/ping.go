@@ -0,0 +1,228 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// pingInterval is the interval between the round trips
+	pingInterval = 500 * time.Millisecond
+	// pingTimeout is how long a gtp round trip can take
+	pingTimeout = 30 * time.Second
+	// pingAnalyzeDuration is how long the analysis runs for each throughput setting
+	pingAnalyzeDuration = 5 * time.Second
+)
+
+// PingSetting represents the transmission settings to test the throughput with
+type PingSetting struct {
+	RefreshInterval int `json:"refreshInterval"`
+	TransmitMoveNum int `json:"transmitMoveNum"`
+}
+
+// LatencyStats represents the round trip times in milliseconds
+type LatencyStats struct {
+	Count   int       `json:"count"`
+	Failed  int       `json:"failed"`
+	Min     float64   `json:"minMillis"`
+	Avg     float64   `json:"avgMillis"`
+	Max     float64   `json:"maxMillis"`
+	Samples []float64 `json:"samplesMillis"`
+}
+
+// ThroughputResult represents the analysis output transmitted with a setting
+type ThroughputResult struct {
+	PingSetting
+	DurationMillis    int64   `json:"durationMillis"`
+	Updates           int     `json:"updates"`
+	ReceivedBytes     int64   `json:"receivedBytes"`
+	DecodedBytes      int64   `json:"decodedBytes"`
+	UpdatesPerSecond  float64 `json:"updatesPerSecond"`
+	ReceivedPerSecond float64 `json:"receivedBytesPerSecond"`
+	Error             string  `json:"error,omitempty"`
+}
+
+// PingReport represents the result of the ping command
+type PingReport struct {
+	Keepalive  LatencyStats       `json:"keepalive"`
+	GTP        LatencyStats       `json:"gtp"`
+	Throughput []ThroughputResult `json:"throughput"`
+}
+
+// ParsePingSettings parses the settings like "30:20,50:10", which are pairs of refresh interval and transmit move num
+func ParsePingSettings(s string) ([]PingSetting, error) {
+	settings := make([]PingSetting, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 {
+			return nil, errors.New("invalid_ping_settings")
+		}
+		refreshInterval, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || refreshInterval <= 0 {
+			return nil, errors.New("invalid_ping_settings")
+		}
+		transmitMoveNum, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || transmitMoveNum <= 0 {
+			return nil, errors.New("invalid_ping_settings")
+		}
+		settings = append(settings, PingSetting{RefreshInterval: refreshInterval, TransmitMoveNum: transmitMoveNum})
+	}
+	return settings, nil
+}
+
+// Ping measures the ssh keepalive and the gtp round trip count times, then the throughput of the analysis
+// with each setting. the settings of the options are used if settings is empty.
+func (client *Client) Ping(options RunKatagoOptions, subCommands []string, count int, settings []PingSetting) (*PingReport, error) {
+	probe, err := client.startProbe(options, subCommands)
+	if err != nil {
+		return nil, err
+	}
+	// wait until the model is loaded
+	_, err = probe.command("name", doctorGTPTimeout)
+	if err != nil {
+		probe.close()
+		return nil, err
+	}
+	keepalives := make([]time.Duration, 0, count)
+	gtps := make([]time.Duration, 0, count)
+	report := &PingReport{Throughput: make([]ThroughputResult, 0)}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(pingInterval)
+		}
+		rtt, err := probe.result.Ping()
+		if err != nil {
+			report.Keepalive.Failed++
+		} else {
+			keepalives = append(keepalives, rtt)
+		}
+		start := time.Now()
+		_, err = probe.command("name", pingTimeout)
+		if err != nil {
+			report.GTP.Failed++
+		} else {
+			gtps = append(gtps, time.Since(start))
+		}
+	}
+	report.Keepalive = newLatencyStats(keepalives, report.Keepalive.Failed)
+	report.GTP = newLatencyStats(gtps, report.GTP.Failed)
+
+	if len(settings) == 0 {
+		setting := PingSetting{RefreshInterval: options.RefreshInterval, TransmitMoveNum: options.TransmitMoveNum}
+		report.Throughput = append(report.Throughput, measureThroughput(probe, setting))
+		probe.close()
+		return report, nil
+	}
+	probe.close()
+	for _, setting := range settings {
+		options.RefreshInterval = setting.RefreshInterval
+		options.TransmitMoveNum = setting.TransmitMoveNum
+		result := ThroughputResult{PingSetting: setting}
+		probe, err := client.startProbe(options, subCommands)
+		if err == nil {
+			_, err = probe.command("name", doctorGTPTimeout)
+			if err == nil {
+				result = measureThroughput(probe, setting)
+			}
+			probe.close()
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		report.Throughput = append(report.Throughput, result)
+	}
+	return report, nil
+}
+
+// measureThroughput runs kata-analyze for a while, and counts the updates and the bytes
+func measureThroughput(probe *gtpProbe, setting PingSetting) ThroughputResult {
+	result := ThroughputResult{PingSetting: setting}
+	before := probe.result.Traffic()
+	start := time.Now()
+	err := probe.send(fmt.Sprintf("kata-analyze %d", setting.RefreshInterval))
+	deadline := time.After(pingAnalyzeDuration)
+	for waiting := err == nil; waiting; {
+		select {
+		case line, ok := <-probe.lines:
+			if !ok {
+				err = probe.exitError()
+				waiting = false
+			} else if strings.HasPrefix(line, "info ") {
+				result.Updates++
+			} else if strings.HasPrefix(line, "?") {
+				err = errors.New("gtp_error")
+				waiting = false
+			}
+		case <-deadline:
+			waiting = false
+		}
+	}
+	if err == nil {
+		// stop the analysis
+		_, err = probe.command("name", pingTimeout)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	duration := time.Since(start)
+	after := probe.result.Traffic()
+	result.DurationMillis = duration.Milliseconds()
+	result.ReceivedBytes = after.Received - before.Received
+	result.DecodedBytes = after.Decoded - before.Decoded
+	result.UpdatesPerSecond = float64(result.Updates) / duration.Seconds()
+	result.ReceivedPerSecond = float64(result.ReceivedBytes) / duration.Seconds()
+	return result
+}
+
+func newLatencyStats(samples []time.Duration, failed int) LatencyStats {
+	stats := LatencyStats{Count: len(samples), Failed: failed, Samples: make([]float64, 0, len(samples))}
+	total := 0.0
+	for i, sample := range samples {
+		millis := float64(sample.Microseconds()) / 1000
+		stats.Samples = append(stats.Samples, millis)
+		total += millis
+		if i == 0 || millis < stats.Min {
+			stats.Min = millis
+		}
+		if millis > stats.Max {
+			stats.Max = millis
+		}
+	}
+	if len(samples) > 0 {
+		stats.Avg = total / float64(len(samples))
+	}
+	return stats
+}
+
+// WritePingReport writes the report to the writer in the given output format
+func WritePingReport(w io.Writer, report *PingReport, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, report)
+	}
+	writeLatency := func(name string, stats LatencyStats) {
+		fmt.Fprintf(w, "%-10s %d ok, %d failed, min/avg/max = %.1f/%.1f/%.1f ms\n", name+":", stats.Count, stats.Failed, stats.Min, stats.Avg, stats.Max)
+	}
+	writeLatency("keepalive", report.Keepalive)
+	writeLatency("gtp", report.GTP)
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REFRESH\tMOVES\tUPDATES/S\tRECEIVED/S\tCOMPRESSION\tERROR")
+	for _, result := range report.Throughput {
+		compression := ""
+		if result.ReceivedBytes > 0 {
+			compression = fmt.Sprintf("%.1fx", float64(result.DecodedBytes)/float64(result.ReceivedBytes))
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%.1f\t%.1fKB\t%s\t%s\n", result.RefreshInterval, result.TransmitMoveNum, result.UpdatesPerSecond, result.ReceivedPerSecond/1024, compression, result.Error)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePingSettings(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []PingSetting
+		wantErr bool
+	}{
+		{s: "", want: []PingSetting{}},
+		{s: "30:20", want: []PingSetting{{RefreshInterval: 30, TransmitMoveNum: 20}}},
+		{s: "30:20,50:10", want: []PingSetting{{RefreshInterval: 30, TransmitMoveNum: 20}, {RefreshInterval: 50, TransmitMoveNum: 10}}},
+		{s: " 30 : 20 , , 50:10,", want: []PingSetting{{RefreshInterval: 30, TransmitMoveNum: 20}, {RefreshInterval: 50, TransmitMoveNum: 10}}},
+		{s: "30", wantErr: true},
+		{s: "30:20:10", wantErr: true},
+		{s: "a:20", wantErr: true},
+		{s: "30:b", wantErr: true},
+		{s: "0:20", wantErr: true},
+		{s: "30:-1", wantErr: true},
+		{s: "30:20,50", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParsePingSettings(test.s)
+		if test.wantErr {
+			if err == nil || err.Error() != "invalid_ping_settings" {
+				t.Errorf("ParsePingSettings(%q): got %v, %v, want invalid_ping_settings", test.s, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePingSettings(%q): %v", test.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParsePingSettings(%q): got %+v, want %+v", test.s, got, test.want)
+		}
+	}
+}
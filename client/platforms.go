@@ -0,0 +1,143 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+
+	"github.com/kinfkong/ikatago-client/platform"
+	"github.com/kinfkong/ikatago-client/utils"
+)
+
+const (
+	// OutputTable prints the result as a human readable table
+	OutputTable = "table"
+	// OutputJSON prints the result as json
+	OutputJSON = "json"
+)
+
+// PlatformInfo represents the description of a platform
+type PlatformInfo struct {
+	Name       string `json:"name"`
+	Discovery  string `json:"discovery"`
+	BaseURL    string `json:"baseUrl"`
+	GetURL     string `json:"getUrl,omitempty"`
+	GetPostURL string `json:"getPostUrl,omitempty"`
+	Bucket     string `json:"bucket,omitempty"`
+	Endpoint   string `json:"bucketEndpoint,omitempty"`
+	SSHJSONURL string `json:"sshJsonUrl,omitempty"`
+}
+
+// FetchWorld fetches the world from the world url
+func FetchWorld(worldURL string) (*platform.World, error) {
+	worldJSONString, err := utils.DoHTTPRequest("GET", worldURL, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	world := &platform.World{}
+	err = json.Unmarshal([]byte(worldJSONString), world)
+	if err != nil {
+		log.Printf("ERROR failed parsing world json: %s\n", worldJSONString)
+		return nil, err
+	}
+	return world, nil
+}
+
+// ListPlatforms lists all the platforms in the world
+func (client *Client) ListPlatforms() ([]PlatformInfo, error) {
+	world, err := FetchWorld(client.Options.World)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]PlatformInfo, 0, len(world.Platforms))
+	for i := range world.Platforms {
+		infos = append(infos, newPlatformInfo(&world.Platforms[i], ""))
+	}
+	return infos, nil
+}
+
+// DescribePlatform describes the platform with the given name
+func (client *Client) DescribePlatform(name string) (*PlatformInfo, error) {
+	world, err := FetchWorld(client.Options.World)
+	if err != nil {
+		return nil, err
+	}
+	p := world.FindPlatform(name)
+	if p == nil {
+		log.Printf("ERROR platform not found in the world. platform: %s", name)
+		return nil, errors.New("platform_not_found")
+	}
+	info := newPlatformInfo(p, client.Options.Username)
+	return &info, nil
+}
+
+// WritePlatforms writes the platforms to the writer in the given output format
+func WritePlatforms(w io.Writer, infos []PlatformInfo, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, infos)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDISCOVERY\tENDPOINT")
+	for _, info := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", info.Name, info.Discovery, info.BaseURL)
+	}
+	return tw.Flush()
+}
+
+// WritePlatform writes the description of the platform to the writer in the given output format
+func WritePlatform(w io.Writer, info *PlatformInfo, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, info)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Name:\t%s\n", info.Name)
+	fmt.Fprintf(tw, "Discovery:\t%s\n", info.Discovery)
+	fmt.Fprintf(tw, "Base URL:\t%s\n", info.BaseURL)
+	if len(info.GetURL) > 0 {
+		fmt.Fprintf(tw, "Get URL:\t%s\n", info.GetURL)
+	}
+	if len(info.GetPostURL) > 0 {
+		fmt.Fprintf(tw, "Get Post URL:\t%s\n", info.GetPostURL)
+	}
+	if len(info.Bucket) > 0 {
+		fmt.Fprintf(tw, "OSS Bucket:\t%s\n", info.Bucket)
+	}
+	if len(info.Endpoint) > 0 {
+		fmt.Fprintf(tw, "OSS Endpoint:\t%s\n", info.Endpoint)
+	}
+	if len(info.SSHJSONURL) > 0 {
+		fmt.Fprintf(tw, "SSH Info URL:\t%s\n", info.SSHJSONURL)
+	}
+	return tw.Flush()
+}
+
+func newPlatformInfo(p *platform.Platform, username string) PlatformInfo {
+	info := PlatformInfo{
+		Name:      p.Name,
+		Discovery: p.DiscoveryType(),
+		BaseURL:   p.BaseURL(),
+		Bucket:    p.Oss.Bucket,
+		Endpoint:  p.Oss.BucketEndpoint,
+	}
+	if p.Http != nil {
+		if p.Http.GetUrl != nil {
+			info.GetURL = *p.Http.GetUrl
+		}
+		if p.Http.GetPostUrl != nil {
+			info.GetPostURL = *p.Http.GetPostUrl
+		}
+	}
+	if len(username) > 0 {
+		info.SSHJSONURL = p.SSHJSONURL(username)
+	}
+	return info
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/utils"
+)
+
+const (
+	// AttachLatest attaches to the latest preloaded katago of the platform and the user
+	AttachLatest = "latest"
+	// maxPreloads is the max number of the preloads kept in the store
+	maxPreloads = 20
+)
+
+// Preload represents a katago preloaded on the server, which the run-katago sessions can attach to.
+// the preloaded katago is kept by the session of the process PID, it is removed from the store when the session ends.
+type Preload struct {
+	ID         string    `json:"id"`
+	PID        int       `json:"pid,omitempty"`
+	Platform   string    `json:"platform"`
+	Username   string    `json:"username"`
+	KataName   string    `json:"kataName,omitempty"`
+	KataWeight string    `json:"kataWeight,omitempty"`
+	KataConfig string    `json:"kataConfig,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// PreloadStore keeps the preloads in a json file, so that the later processes can attach to them
+type PreloadStore struct {
+	Path string
+}
+
+// DefaultPreloadStore returns the store in ~/.ikatago/preloads.json
+func DefaultPreloadStore() (*PreloadStore, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &PreloadStore{Path: filepath.Join(home, ".ikatago", "preloads.json")}, nil
+}
+
+// NewPreloadID generates a random id of the preload
+func NewPreloadID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// List returns the preloads, the latest first
+func (store *PreloadStore) List() ([]Preload, error) {
+	preloads := make([]Preload, 0)
+	if !utils.FileExists(store.Path) {
+		return preloads, nil
+	}
+	content, err := ioutil.ReadFile(store.Path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &preloads)
+	if err != nil {
+		log.Printf("ERROR failed parsing preloads file: %s, err: %v\n", store.Path, err)
+		return nil, errors.New("invalid_preloads_file")
+	}
+	sort.SliceStable(preloads, func(i, j int) bool {
+		return preloads[i].CreatedAt.After(preloads[j].CreatedAt)
+	})
+	return preloads, nil
+}
+
+// Add adds the preload, only the latest preloads are kept
+func (store *PreloadStore) Add(preload Preload) error {
+	return store.update(func(preloads []Preload) ([]Preload, error) {
+		preloads = append([]Preload{preload}, preloads...)
+		if len(preloads) > maxPreloads {
+			preloads = preloads[:maxPreloads]
+		}
+		return preloads, nil
+	})
+}
+
+// Remove removes the preload by id
+func (store *PreloadStore) Remove(id string) error {
+	return store.update(func(preloads []Preload) ([]Preload, error) {
+		kept := make([]Preload, 0, len(preloads))
+		for _, preload := range preloads {
+			if preload.ID != id {
+				kept = append(kept, preload)
+			}
+		}
+		if len(kept) == len(preloads) {
+			return nil, errors.New("preload_not_found")
+		}
+		return kept, nil
+	})
+}
+
+// Prune removes the preloads whose process has exited without removing them, like being killed.
+// it returns the live preloads, the latest first.
+func (store *PreloadStore) Prune() ([]Preload, error) {
+	preloads, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	if !hasDeadPreload(preloads) {
+		return preloads, nil
+	}
+	var alive []Preload
+	err = store.update(func(preloads []Preload) ([]Preload, error) {
+		// read again under the lock, the other processes may have changed the preloads
+		alive = make([]Preload, 0, len(preloads))
+		for _, preload := range preloads {
+			if preload.Alive() {
+				alive = append(alive, preload)
+			} else {
+				log.Printf("DEBUG removing the preload of the exited process. id: %s, pid: %d\n", preload.ID, preload.PID)
+			}
+		}
+		return alive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return alive, nil
+}
+
+func hasDeadPreload(preloads []Preload) bool {
+	for _, preload := range preloads {
+		if !preload.Alive() {
+			return true
+		}
+	}
+	return false
+}
+
+// Find finds the live preload of the platform and the user by id, or the latest one if id is AttachLatest
+func (store *PreloadStore) Find(platform string, username string, id string) (*Preload, error) {
+	preloads, err := store.Prune()
+	if err != nil {
+		return nil, err
+	}
+	for _, preload := range preloads {
+		if preload.Platform != platform || preload.Username != username {
+			continue
+		}
+		if id == AttachLatest || preload.ID == id {
+			return &preload, nil
+		}
+	}
+	log.Printf("ERROR preload not found. platform: %s, user: %s, id: %s\n", platform, username, id)
+	return nil, errors.New("preload_not_found")
+}
+
+// Alive checks if the process keeping the preloaded katago is running. the preloads without pid are treated as alive.
+func (preload *Preload) Alive() bool {
+	if preload.PID <= 0 {
+		return true
+	}
+	process, err := os.FindProcess(preload.PID)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens the process on windows, it fails if the process does not exist
+		process.Release()
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// update reads, changes and writes the preloads under the lock of the file, so that the processes adding
+// and removing the preloads at the same time do not drop the changes of each other
+func (store *PreloadStore) update(change func(preloads []Preload) ([]Preload, error)) error {
+	err := os.MkdirAll(filepath.Dir(store.Path), 0700)
+	if err != nil {
+		return err
+	}
+	unlock, err := utils.LockFile(store.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	preloads, err := store.List()
+	if err != nil {
+		return err
+	}
+	preloads, err = change(preloads)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(preloads, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the readers without the lock never see a partially written file
+	return utils.WriteFileAtomic(store.Path, content, 0600)
+}
+
+// maxTailSize is the max size of the output kept by tailWriter
+const maxTailSize = 4096
+
+// tailWriter forwards the output, and keeps the last part of it
+type tailWriter struct {
+	writer io.Writer
+	lock   sync.Mutex
+	tail   []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	w.tail = append(w.tail, p...)
+	if len(w.tail) > maxTailSize {
+		w.tail = w.tail[len(w.tail)-maxTailSize:]
+	}
+	w.lock.Unlock()
+	return w.writer.Write(p)
+}
+
+// String returns the last part of the output
+func (w *tailWriter) String() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return string(w.tail)
+}
+
+// WritePreloads writes the preloads in the output format, table or json
+func WritePreloads(w io.Writer, preloads []Preload, output string) error {
+	if output == "json" {
+		return writeJSON(w, preloads)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPLATFORM\tUSER\tWEIGHT\tCONFIG\tPID\tCREATED")
+	for _, preload := range preloads {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", preload.ID, preload.Platform, preload.Username, preload.KataWeight, preload.KataConfig, preload.PID, preload.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPreloadStorePrune(t *testing.T) {
+	exited := exec.Command("go", "version")
+	if err := exited.Run(); err != nil {
+		t.Skip("cannot run a process: ", err)
+	}
+	store := &PreloadStore{Path: filepath.Join(t.TempDir(), "preloads.json")}
+	now := time.Now()
+	preloads := []Preload{
+		{ID: "exited", PID: exited.Process.Pid, Platform: "colab", Username: "foo", CreatedAt: now},
+		{ID: "running", PID: os.Getpid(), Platform: "colab", Username: "foo", CreatedAt: now.Add(-time.Minute)},
+		{ID: "unknown", Platform: "colab", Username: "foo", CreatedAt: now.Add(-time.Hour)},
+	}
+	for _, preload := range preloads {
+		if err := store.Add(preload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	preload, err := store.Find("colab", "foo", AttachLatest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preload.ID != "running" {
+		t.Errorf("latest: got %s, want running", preload.ID)
+	}
+	left, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 2 {
+		t.Errorf("the preload of the exited process is not removed: %+v", left)
+	}
+	if _, err := store.Find("colab", "foo", "exited"); err == nil {
+		t.Error("found the preload of the exited process")
+	}
+}
+
+func TestPreloadStoreConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preloads.json")
+	// like the preload-katago processes adding while the run-katago processes read and prune
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			store := &PreloadStore{Path: path}
+			if err := store.Add(Preload{ID: fmt.Sprintf("p%d", i), PID: os.Getpid(), Platform: "colab", Username: "foo", CreatedAt: time.Now()}); err != nil {
+				t.Errorf("Add: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			store := &PreloadStore{Path: path}
+			if _, err := store.Prune(); err != nil {
+				t.Errorf("Prune: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	preloads, err := (&PreloadStore{Path: path}).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preloads) != 10 {
+		t.Errorf("got %d preloads, want 10: %+v", len(preloads), preloads)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("the lock file is left: %v", err)
+	}
+}
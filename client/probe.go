@@ -0,0 +1,145 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// gtpProbe runs katago and sends the gtp commands one by one, it is used by the diagnostic commands
+type gtpProbe struct {
+	result *SessionResult
+	input  *io.PipeWriter
+	lines  chan string
+	stderr *lockedBuffer
+}
+
+// startProbe starts katago and waits until the remote command is started
+func (client *Client) startProbe(options RunKatagoOptions, subCommands []string) (*gtpProbe, error) {
+	options.UseRawData = false
+	options.FallbackKatago = nil
+	options.RecordFile = nil
+	inputReader, inputWriter := io.Pipe()
+	outputReader, outputWriter := io.Pipe()
+	probe := &gtpProbe{
+		input:  inputWriter,
+		lines:  make(chan string, 1024),
+		stderr: &lockedBuffer{},
+	}
+	ready := make(chan struct{})
+	result, err := client.RunKatago(options, subCommands, inputReader, outputWriter, probe.stderr, func() {
+		close(ready)
+	})
+	if err != nil {
+		return nil, err
+	}
+	probe.result = result
+	go func() {
+		<-result.Done()
+		inputReader.CloseWithError(errors.New("katago_exited"))
+		outputWriter.Close()
+	}()
+	go func() {
+		defer close(probe.lines)
+		scanner := bufio.NewScanner(outputReader)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			probe.lines <- strings.TrimRight(scanner.Text(), "\r")
+		}
+		io.Copy(ioutil.Discard, outputReader)
+	}()
+	select {
+	case <-ready:
+		return probe, nil
+	case <-result.Done():
+		return nil, probe.exitError()
+	}
+}
+
+// send sends the command without waiting for the response
+func (probe *gtpProbe) send(line string) error {
+	_, err := io.WriteString(probe.input, line+"\n")
+	return err
+}
+
+// command sends the command and waits for the first line of its response, the earlier output is skipped
+func (probe *gtpProbe) command(line string, timeout time.Duration) (string, error) {
+	err := probe.send(line)
+	if err != nil {
+		return "", probe.exitError()
+	}
+	return probe.response(timeout)
+}
+
+// response waits for the first line of the next response, and skips the rest of it
+func (probe *gtpProbe) response(timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case line, ok := <-probe.lines:
+			if !ok {
+				return "", probe.exitError()
+			}
+			if !strings.HasPrefix(line, "=") && !strings.HasPrefix(line, "?") {
+				continue
+			}
+			probe.skipResponse()
+			if strings.HasPrefix(line, "?") {
+				return line, errors.New("gtp_error")
+			}
+			return strings.TrimSpace(strings.TrimLeft(line, "=0123456789")), nil
+		case <-deadline:
+			return "", errors.New("gtp_timeout")
+		}
+	}
+}
+
+// skipResponse skips the lines until the end of the current response
+func (probe *gtpProbe) skipResponse() {
+	for {
+		select {
+		case line, ok := <-probe.lines:
+			if !ok || len(line) == 0 {
+				return
+			}
+		case <-time.After(time.Second):
+			// the response of kata-analyze ends only when the next command is sent
+			return
+		}
+	}
+}
+
+// exitError returns the error of the exited katago
+func (probe *gtpProbe) exitError() error {
+	select {
+	case <-probe.result.Done():
+	case <-time.After(10 * time.Second):
+		return errors.New("katago_exited")
+	}
+	probe.result.Wait()
+	if probe.result.Err != nil {
+		return probe.result.Err
+	}
+	return errors.New("katago_exited")
+}
+
+// lastLog returns the last line of the katago stderr
+func (probe *gtpProbe) lastLog() string {
+	lines := strings.Split(strings.TrimSpace(probe.stderr.String()), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// close quits katago
+func (probe *gtpProbe) close() {
+	probe.send("quit")
+	probe.input.Close()
+	select {
+	case <-probe.result.Done():
+	case <-time.After(10 * time.Second):
+		probe.result.Stop()
+	}
+	probe.result.Wait()
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// RecordStdin is the stream of the gtp commands sent to katago
+	RecordStdin = "stdin"
+	// RecordStdout is the stream of the decoded katago output
+	RecordStdout = "stdout"
+	// RecordStderr is the stream of the katago logs
+	RecordStderr = "stderr"
+)
+
+// RecordEntry represents a chunk of the traffic of a session, one json object per line in the record file
+type RecordEntry struct {
+	Time    time.Time `json:"time"`
+	Elapsed int64     `json:"elapsedMillis"`
+	Stream  string    `json:"stream"`
+	Data    string    `json:"data"`
+}
+
+// Recorder records the traffic of a katago session into a file
+type Recorder struct {
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	start   time.Time
+}
+
+type recordReader struct {
+	recorder *Recorder
+	stream   string
+	reader   io.Reader
+}
+
+type recordWriter struct {
+	recorder *Recorder
+	stream   string
+	writer   io.Writer
+}
+
+// NewRecorder creates the record file, the existing file is truncated
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		log.Printf("ERROR cannot create the record file: %s\n", path)
+		return nil, err
+	}
+	return &Recorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+		start:   time.Now(),
+	}, nil
+}
+
+// Record records a chunk of the stream
+func (recorder *Recorder) Record(stream string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	now := time.Now()
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.file == nil {
+		return
+	}
+	err := recorder.encoder.Encode(RecordEntry{
+		Time:    now,
+		Elapsed: now.Sub(recorder.start).Milliseconds(),
+		Stream:  stream,
+		Data:    string(data),
+	})
+	if err != nil {
+		log.Printf("ERROR failed to write the record file: %v\n", err)
+	}
+}
+
+// Reader returns the reader which records what is read from reader
+func (recorder *Recorder) Reader(stream string, reader io.Reader) io.Reader {
+	return &recordReader{recorder: recorder, stream: stream, reader: reader}
+}
+
+// Writer returns the writer which records what is written to writer
+func (recorder *Recorder) Writer(stream string, writer io.Writer) io.Writer {
+	return &recordWriter{recorder: recorder, stream: stream, writer: writer}
+}
+
+// Close closes the record file
+func (recorder *Recorder) Close() error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if recorder.file == nil {
+		return nil
+	}
+	err := recorder.file.Close()
+	recorder.file = nil
+	return err
+}
+
+func (r *recordReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.recorder.Record(r.stream, p[:n])
+	return n, err
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	w.recorder.Record(w.stream, p)
+	return w.writer.Write(p)
+}
+
+// ReadRecord reads the entries of the record file
+func ReadRecord(path string) ([]RecordEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("ERROR cannot open the record file: %s\n", path)
+		return nil, err
+	}
+	defer file.Close()
+	entries := make([]RecordEntry, 0)
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		entry := RecordEntry{}
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("ERROR failed parsing the record file: %s, err: %v\n", path, err)
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayDiff represents a response of the replay which differs from the record
+type ReplayDiff struct {
+	Index    int    `json:"index"`
+	Command  string `json:"command"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// replayQuitTimeout is how long the replay waits for katago to exit after quit
+const replayQuitTimeout = 30 * time.Second
+
+type replayCommand struct {
+	line    string
+	elapsed int64
+}
+
+// lockedBuffer is a buffer which can be written by the session and read by the replay
+type lockedBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buffer.String()
+}
+
+// Replay sends the recorded gtp commands to a new katago session with the recorded timing, and diffs
+// the responses with the recorded ones. the info lines of the analysis are not compared.
+func (client *Client) Replay(options RunKatagoOptions, subCommands []string, entries []RecordEntry, outputWriter io.Writer, stderrWriter io.Writer) ([]ReplayDiff, error) {
+	commands := recordedCommands(entries)
+	if len(commands) == 0 {
+		return nil, errors.New("no_recorded_commands")
+	}
+	inputReader, inputWriter := io.Pipe()
+	output := &lockedBuffer{}
+	ready := make(chan struct{})
+	result, err := client.RunKatago(options, subCommands, inputReader, io.MultiWriter(output, outputWriter), stderrWriter, func() {
+		close(ready)
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ready:
+	case <-result.Done():
+		result.Wait()
+		if result.Err == nil {
+			return nil, errors.New("session_exited")
+		}
+		return nil, result.Err
+	}
+
+	start := time.Now()
+	quit := false
+	for _, command := range commands {
+		delay := time.Duration(command.elapsed-commands[0].elapsed)*time.Millisecond - time.Since(start)
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		_, err := io.WriteString(inputWriter, command.line+"\n")
+		if err != nil {
+			break
+		}
+		if GTPCommandName(command.line) == "quit" {
+			quit = true
+			break
+		}
+	}
+	if !quit {
+		io.WriteString(inputWriter, "quit\n")
+	}
+	select {
+	case <-result.Done():
+	case <-time.After(replayQuitTimeout):
+		result.Stop()
+	}
+	result.Wait()
+	inputWriter.Close()
+	return diffResponses(commands, recordedResponses(entries), splitResponses(output.String())), result.Err
+}
+
+// recordedCommands returns the gtp command lines sent to katago in the record
+func recordedCommands(entries []RecordEntry) []replayCommand {
+	commands := make([]replayCommand, 0)
+	pending := ""
+	for _, entry := range entries {
+		if entry.Stream != RecordStdin {
+			continue
+		}
+		pending += entry.Data
+		for {
+			index := strings.Index(pending, "\n")
+			if index < 0 {
+				break
+			}
+			line := strings.TrimSpace(pending[:index])
+			pending = pending[index+1:]
+			if len(line) > 0 && !strings.HasPrefix(line, "#") {
+				commands = append(commands, replayCommand{line: line, elapsed: entry.Elapsed})
+			}
+		}
+	}
+	return commands
+}
+
+// recordedResponses returns the gtp responses of katago in the record
+func recordedResponses(entries []RecordEntry) []string {
+	builder := &strings.Builder{}
+	for _, entry := range entries {
+		if entry.Stream == RecordStdout {
+			builder.WriteString(entry.Data)
+		}
+	}
+	return splitResponses(builder.String())
+}
+
+// splitResponses splits the gtp output into the responses, which end with an empty line
+func splitResponses(output string) []string {
+	responses := make([]string, 0)
+	lines := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "info ") {
+			continue
+		}
+		if len(line) == 0 {
+			if len(lines) > 0 {
+				responses = append(responses, strings.Join(lines, "\n"))
+				lines = lines[:0]
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		responses = append(responses, strings.Join(lines, "\n"))
+	}
+	return responses
+}
+
+func diffResponses(commands []replayCommand, expected []string, actual []string) []ReplayDiff {
+	diffs := make([]ReplayDiff, 0)
+	for i, command := range commands {
+		e := ""
+		if i < len(expected) {
+			e = expected[i]
+		}
+		a := ""
+		if i < len(actual) {
+			a = actual[i]
+		}
+		if e != a {
+			diffs = append(diffs, ReplayDiff{Index: i + 1, Command: command.line, Expected: e, Actual: a})
+		}
+	}
+	return diffs
+}
+
+// WriteReplayDiffs writes the differences of the replay in the given output format
+func WriteReplayDiffs(w io.Writer, diffs []ReplayDiff, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, diffs)
+	}
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintln(w, "all the responses are the same as the record")
+		return err
+	}
+	for _, diff := range diffs {
+		fmt.Fprintf(w, "#%d %s\n", diff.Index, diff.Command)
+		for _, line := range strings.Split(diff.Expected, "\n") {
+			fmt.Fprintf(w, "- %s\n", line)
+		}
+		for _, line := range strings.Split(diff.Actual, "\n") {
+			fmt.Fprintf(w, "+ %s\n", line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordedCommands(t *testing.T) {
+	entries := []RecordEntry{
+		{Elapsed: 0, Stream: RecordStdin, Data: "version\n# a comment\n\n"},
+		{Elapsed: 5, Stream: RecordStdout, Data: "= 1.12.0\n\n"},
+		// a command split into two chunks
+		{Elapsed: 10, Stream: RecordStdin, Data: "kata-analyze B"},
+		{Elapsed: 20, Stream: RecordStdin, Data: " 50\r\nquit\n"},
+		{Elapsed: 30, Stream: RecordStderr, Data: "quit\n"},
+	}
+	want := []replayCommand{{"version", 0}, {"kata-analyze B 50", 20}, {"quit", 20}}
+	if got := recordedCommands(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitResponses(t *testing.T) {
+	output := "= 1.12.0\n\n=\ninfo move D4 visits 10\r\ninfo move Q16 visits 20\n\n= D4\nplay D4\n\n? unknown command\r\n\r\n= partial"
+	want := []string{"= 1.12.0", "=", "= D4\nplay D4", "? unknown command", "= partial"}
+	if got := splitResponses(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDiffResponses(t *testing.T) {
+	commands := []replayCommand{{line: "version"}, {line: "name"}, {line: "quit"}}
+	diffs := diffResponses(commands, []string{"= 1.12.0", "= KataGo", "="}, []string{"= 1.12.0", "= KataGo2"})
+	want := []ReplayDiff{
+		{Index: 2, Command: "name", Expected: "= KataGo", Actual: "= KataGo2"},
+		{Index: 3, Command: "quit", Expected: "=", Actual: ""},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("got %+v, want %+v", diffs, want)
+	}
+}
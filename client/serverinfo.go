@@ -0,0 +1,186 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ServerInfo represents the parsed result of query-server
+type ServerInfo struct {
+	GpuTypes    []string          `json:"gpuTypes"`
+	EngineTypes []string          `json:"engineTypes"`
+	Weights     []string          `json:"weights"`
+	Configs     []string          `json:"configs"`
+	KataNames   []string          `json:"kataNames"`
+	Queue       *int              `json:"queue,omitempty"`
+	Usage       string            `json:"usage,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	Raw         string            `json:"raw"`
+}
+
+// serverInfoKeys maps the normalized keys of the query-server output to the fields
+var serverInfoKeys = map[string]string{
+	"gpu":         "gpuTypes",
+	"gpus":        "gpuTypes",
+	"gputype":     "gpuTypes",
+	"gputypes":    "gpuTypes",
+	"engine":      "engineTypes",
+	"engines":     "engineTypes",
+	"enginetype":  "engineTypes",
+	"enginetypes": "engineTypes",
+	"weight":      "weights",
+	"weights":     "weights",
+	"config":      "configs",
+	"configs":     "configs",
+	"kataname":    "kataNames",
+	"katanames":   "kataNames",
+	"katago":      "kataNames",
+	"queue":       "queue",
+	"queuelength": "queue",
+	"queuesize":   "queue",
+	"usage":       "usage",
+}
+
+// QueryServerInfo queries the server and parses the result
+func (client *Client) QueryServerInfo() (*ServerInfo, error) {
+	buf := bytes.NewBuffer(nil)
+	err := client.QueryServer(buf)
+	if err != nil {
+		return nil, err
+	}
+	return ParseServerInfo(buf.String()), nil
+}
+
+// ParseServerInfo parses the output of query-server. the output can be json, or text lines like
+// "weights: 20b, 40b" or a "weights:" line followed by the indented items. unknown keys are kept in Extra.
+func ParseServerInfo(raw string) *ServerInfo {
+	info := &ServerInfo{Raw: raw}
+	trimmed := strings.TrimSpace(raw)
+	if strings.HasPrefix(trimmed, "{") && json.Unmarshal([]byte(trimmed), info) == nil {
+		info.Raw = raw
+		info.normalize()
+		return info
+	}
+	section := ""
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		item := strings.TrimSpace(line)
+		isItem := strings.HasPrefix(item, "- ") || strings.HasPrefix(item, "* ")
+		if len(section) > 0 && (indented || isItem || !strings.Contains(item, ":")) {
+			item = strings.TrimSpace(strings.TrimLeft(item, "-*"))
+			fields := strings.Fields(item)
+			if len(fields) > 0 {
+				info.add(section, strings.TrimRight(fields[0], ":,"))
+			}
+			continue
+		}
+		index := strings.Index(item, ":")
+		if index < 0 {
+			section = ""
+			continue
+		}
+		key := item[:index]
+		value := strings.TrimSpace(item[index+1:])
+		field, ok := serverInfoKeys[normalizeServerInfoKey(key)]
+		if !ok && len(strings.Fields(key)) > 1 {
+			// like "available weights"
+			words := strings.Fields(key)
+			field, ok = serverInfoKeys[normalizeServerInfoKey(words[len(words)-1])]
+		}
+		if !ok {
+			section = ""
+			info.setExtra(strings.TrimSpace(key), value)
+			continue
+		}
+		if len(value) == 0 {
+			section = field
+			continue
+		}
+		section = ""
+		info.set(field, value)
+	}
+	info.normalize()
+	return info
+}
+
+func normalizeServerInfoKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(key)
+}
+
+// set sets the field with the value on the same line as the key
+func (info *ServerInfo) set(field string, value string) {
+	if field == "queue" {
+		queue, err := strconv.Atoi(strings.Fields(value)[0])
+		if err == nil {
+			info.Queue = &queue
+		} else {
+			info.setExtra(field, value)
+		}
+		return
+	}
+	if field == "usage" {
+		info.Usage = value
+		return
+	}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			info.add(field, item)
+		}
+	}
+}
+
+// add adds the item to the list field
+func (info *ServerInfo) add(field string, item string) {
+	switch field {
+	case "gpuTypes":
+		info.GpuTypes = append(info.GpuTypes, item)
+	case "engineTypes":
+		info.EngineTypes = append(info.EngineTypes, item)
+	case "weights":
+		info.Weights = append(info.Weights, item)
+	case "configs":
+		info.Configs = append(info.Configs, item)
+	case "kataNames":
+		info.KataNames = append(info.KataNames, item)
+	case "queue", "usage":
+		info.set(field, item)
+	default:
+		info.setExtra(field, item)
+	}
+}
+
+func (info *ServerInfo) setExtra(key string, value string) {
+	if info.Extra == nil {
+		info.Extra = make(map[string]string)
+	}
+	info.Extra[key] = value
+}
+
+// normalize makes the lists non-nil, so that they are written as [] in json
+func (info *ServerInfo) normalize() {
+	lists := []*[]string{&info.GpuTypes, &info.EngineTypes, &info.Weights, &info.Configs, &info.KataNames}
+	for _, list := range lists {
+		if *list == nil {
+			*list = make([]string, 0)
+		}
+	}
+}
+
+// WriteServerInfo writes the server info to the writer in the given output format, the table format
+// writes the original text of the server
+func WriteServerInfo(w io.Writer, info *ServerInfo, output string) error {
+	if output == OutputJSON {
+		return writeJSON(w, info)
+	}
+	_, err := io.WriteString(w, info.Raw)
+	return err
+}
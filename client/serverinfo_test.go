@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestParseServerInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want ServerInfo
+	}{
+		{
+			name: "json",
+			raw:  `{"gpuTypes":["1x","2x"],"weights":["20b","40b"],"queue":3,"usage":"1/4"}` + "\n",
+			want: ServerInfo{GpuTypes: []string{"1x", "2x"}, EngineTypes: []string{}, Weights: []string{"20b", "40b"}, Configs: []string{}, KataNames: []string{}, Queue: intPtr(3), Usage: "1/4"},
+		},
+		{
+			name: "key value lines",
+			raw:  "GPU types: 1x, 2x, 4x\r\nengine_type: cuda,trt\r\nAvailable weights: 20b, 40b, 60b\r\nqueue: 2 sessions waiting\r\nusage: 25%\r\nserver version: 1.6.0\r\n",
+			want: ServerInfo{
+				GpuTypes:    []string{"1x", "2x", "4x"},
+				EngineTypes: []string{"cuda", "trt"},
+				Weights:     []string{"20b", "40b", "60b"},
+				Configs:     []string{},
+				KataNames:   []string{},
+				Queue:       intPtr(2),
+				Usage:       "25%",
+				Extra:       map[string]string{"server version": "1.6.0"},
+			},
+		},
+		{
+			name: "indented lists",
+			raw: `weights:
+  20b  (kata1-b20c256x2-s5303129600-d1228401921)
+  - 40b
+configs:
+  * default_gtp.cfg
+katago:
+	katago-1.12.0
+queue-length: 0
+`,
+			want: ServerInfo{
+				GpuTypes:    []string{},
+				EngineTypes: []string{},
+				Weights:     []string{"20b", "40b"},
+				Configs:     []string{"default_gtp.cfg"},
+				KataNames:   []string{"katago-1.12.0"},
+				Queue:       intPtr(0),
+			},
+		},
+		{
+			name: "unknown queue",
+			raw:  "queue: unknown\nweights: 40b\n",
+			want: ServerInfo{GpuTypes: []string{}, EngineTypes: []string{}, Weights: []string{"40b"}, Configs: []string{}, KataNames: []string{}, Extra: map[string]string{"queue": "unknown"}},
+		},
+		{
+			name: "plain text",
+			raw:  "the server is ready\n",
+			want: ServerInfo{GpuTypes: []string{}, EngineTypes: []string{}, Weights: []string{}, Configs: []string{}, KataNames: []string{}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := ParseServerInfo(test.raw)
+			test.want.Raw = test.raw
+			if !reflect.DeepEqual(*info, test.want) {
+				got, _ := json.Marshal(info)
+				want, _ := json.Marshal(test.want)
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
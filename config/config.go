@@ -0,0 +1,281 @@
+// Package config loads the named profiles from the config file and merges them with the command line.
+//
+// The precedence of an option, from the highest to the lowest, is:
+//  1. the command line flag, like --gpu-type
+//  2. the environment variable, like IKATAGO_PROFILE
+//  3. the selected profile in the config file
+//  4. the default value of the flag
+//
+// The config file is a yaml file, by default ~/.ikatago/config.yaml. The keys of a profile are the long
+// names of the command line flags, for example:
+//
+//	default-profile: aistudio
+//	profiles:
+//	  aistudio:
+//	    platform: aistudio
+//	    username: kinfkong
+//	    password-env: IKATAGO_AISTUDIO_PASSWORD
+//	    gpu-type: 2x
+//	    kata-weight: 40b
+//	    kata-override-config: analysisPVLen=30
+//	    subcommands: [analysis, -analysis-threads, "12"]
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/kinfkong/ikatago-client/model"
+	"github.com/kinfkong/ikatago-client/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SubCommandsKey is the profile key of the katago subcommands
+	SubCommandsKey = "subcommands"
+	// PasswordEnvKey is the profile key of the environment variable name which holds the password
+	PasswordEnvKey = "password-env"
+)
+
+// Profile represents a named set of options, keyed by the long names of the flags
+type Profile map[string]interface{}
+
+// File represents the config file
+type File struct {
+	DefaultProfile string             `yaml:"default-profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+// DefaultPath returns the default path of the config file
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ikatago", "config.yaml")
+}
+
+// Load loads the config file
+func Load(path string) (*File, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("ERROR cannot read config file: %s\n", path)
+		return nil, err
+	}
+	file := &File{}
+	err = yaml.Unmarshal(content, file)
+	if err != nil {
+		log.Printf("ERROR failed parsing config file: %s, err: %v\n", path, err)
+		return nil, err
+	}
+	return file, nil
+}
+
+// Profile gets the profile by name, the default profile is used if name is empty
+func (file *File) Profile(name string) (Profile, error) {
+	if len(name) == 0 {
+		name = file.DefaultProfile
+	}
+	if len(name) == 0 {
+		return nil, nil
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		log.Printf("ERROR profile not found in the config file. profile: %s\n", name)
+		return nil, errors.New("profile_not_found")
+	}
+	return profile, nil
+}
+
+// SetProfileValue sets the value of the key in the profile of the config file, the comments and the other
+// keys are kept. the file and the profile are created if they do not exist.
+func SetProfileValue(path string, profileName string, key string, value string) error {
+	root := &yaml.Node{}
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("ERROR cannot read config file: %s\n", path)
+		return err
+	}
+	if err == nil {
+		err = yaml.Unmarshal(content, root)
+		if err != nil {
+			log.Printf("ERROR failed parsing config file: %s, err: %v\n", path, err)
+			return err
+		}
+	}
+	if len(root.Content) == 0 {
+		root = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if root.Content[0].Kind != yaml.MappingNode {
+		return errors.New("invalid_config_file")
+	}
+	profiles := mappingValue(root.Content[0], "profiles")
+	profile := mappingValue(profiles, profileName)
+	node := mappingValue(profile, key)
+	node.Kind = yaml.ScalarNode
+	node.Tag = "!!str"
+	node.Value = value
+	node.Content = nil
+
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(root)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// mappingValue returns the value node of the key in the mapping node, it is added if not found
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		mapping.Kind = yaml.MappingNode
+		mapping.Tag = ""
+		mapping.Value = ""
+		mapping.Content = nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+// ParseArgs parses the args into the options, merged with the environment variables and the selected profile
+func ParseArgs(args []string) (*model.AllOpts, []string, error) {
+	return parseArgs(args, nil)
+}
+
+// ParseArgsWithProfile parses the args like ParseArgs, but loads the given profile instead of the one in the args
+func ParseArgsWithProfile(args []string, profileName string) (*model.AllOpts, []string, error) {
+	return parseArgs(args, &profileName)
+}
+
+func parseArgs(args []string, profileName *string) (*model.AllOpts, []string, error) {
+	opts := &model.AllOpts{}
+	subCommands, err := flags.NewParser(opts, flags.Default).ParseArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if profileName != nil {
+		opts.Profile = profileName
+	}
+	configPath := ""
+	if opts.Config != nil {
+		configPath = *opts.Config
+	} else if utils.FileExists(DefaultPath()) {
+		configPath = DefaultPath()
+	}
+	if len(configPath) == 0 {
+		return opts, subCommands, nil
+	}
+	file, err := Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := ""
+	if opts.Profile != nil {
+		name = *opts.Profile
+	}
+	profile, err := file.Profile(name)
+	if err != nil || profile == nil {
+		return opts, subCommands, err
+	}
+
+	// parse again with the profile options in front, so that the command line flags win
+	opts = &model.AllOpts{}
+	parser := flags.NewParser(opts, flags.Default)
+	profileArgs, err := profile.toArgs(parser)
+	if err != nil {
+		return nil, nil, err
+	}
+	subCommands, err = parser.ParseArgs(append(profileArgs, args...))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(subCommands) == 0 {
+		subCommands, err = profile.subCommands()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(opts.Password) == 0 {
+		if envName, ok := profile[PasswordEnvKey].(string); ok {
+			opts.Password = os.Getenv(envName)
+		}
+	}
+	return opts, subCommands, nil
+}
+
+// toArgs converts the profile into the command line args. the options whose environment variables are set are skipped.
+func (profile Profile) toArgs(parser *flags.Parser) ([]string, error) {
+	keys := make([]string, 0, len(profile))
+	for key := range profile {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0)
+	for _, key := range keys {
+		if key == SubCommandsKey || key == PasswordEnvKey {
+			continue
+		}
+		option := parser.FindOptionByLongName(key)
+		if option == nil || key == "config" || key == "profile" {
+			log.Printf("ERROR unknown key in the profile: %s\n", key)
+			return nil, errors.New("unknown_profile_key")
+		}
+		if len(option.EnvDefaultKey) > 0 {
+			if _, ok := os.LookupEnv(option.EnvDefaultKey); ok {
+				continue
+			}
+		}
+		value := profile[key]
+		if option.Field().Type.Kind() == reflect.Bool {
+			enabled, ok := value.(bool)
+			if !ok {
+				log.Printf("ERROR the profile key %s must be a boolean\n", key)
+				return nil, errors.New("invalid_profile_value")
+			}
+			if enabled {
+				args = append(args, "--"+key)
+			}
+			continue
+		}
+		args = append(args, "--"+key, fmt.Sprint(value))
+	}
+	return args, nil
+}
+
+func (profile Profile) subCommands() ([]string, error) {
+	value, ok := profile[SubCommandsKey]
+	if !ok {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		log.Printf("ERROR the profile key %s must be a list\n", SubCommandsKey)
+		return nil, errors.New("invalid_profile_value")
+	}
+	subCommands := make([]string, 0, len(items))
+	for _, item := range items {
+		subCommands = append(subCommands, fmt.Sprint(item))
+	}
+	return subCommands, nil
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+default-profile: colab
+profiles:
+  colab:
+    platform: colab
+    username: profile-user
+    password-env: TEST_IKATAGO_PASSWORD
+    refresh-interval: 50
+    kata-weight: 40b
+    no-compress: true
+    subcommands: [analysis, -analysis-threads, "12"]
+  aistudio:
+    platform: aistudio
+    username: other-user
+`
+
+func writeTestConfig(t *testing.T) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	err := ioutil.WriteFile(path, []byte(testConfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no config file in the home, so that only the test config is used
+	t.Setenv("HOME", dir)
+	t.Setenv("USERPROFILE", dir)
+	return path
+}
+
+func TestParseArgsPrecedence(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		env             map[string]string
+		refreshInterval int
+		kataWeight      string
+		username        string
+		password        string
+		subCommands     []string
+	}{
+		{
+			name:            "default",
+			args:            []string{"--profile", "aistudio"},
+			refreshInterval: 30,
+			username:        "other-user",
+		},
+		{
+			name:            "profile",
+			args:            []string{},
+			env:             map[string]string{"TEST_IKATAGO_PASSWORD": "secret"},
+			refreshInterval: 50,
+			kataWeight:      "40b",
+			username:        "profile-user",
+			password:        "secret",
+			subCommands:     []string{"analysis", "-analysis-threads", "12"},
+		},
+		{
+			name:            "env over profile",
+			args:            []string{},
+			env:             map[string]string{"IKATAGO_REFRESH_INTERVAL": "60", "IKATAGO_KATA_WEIGHT": "60b"},
+			refreshInterval: 60,
+			kataWeight:      "60b",
+			username:        "profile-user",
+			subCommands:     []string{"analysis", "-analysis-threads", "12"},
+		},
+		{
+			name:            "flag over env",
+			args:            []string{"--refresh-interval", "70", "-u", "flag-user", "--password", "flag-password", "--", "gtp"},
+			env:             map[string]string{"IKATAGO_REFRESH_INTERVAL": "60", "IKATAGO_USERNAME": "env-user", "TEST_IKATAGO_PASSWORD": "secret"},
+			refreshInterval: 70,
+			kataWeight:      "40b",
+			username:        "flag-user",
+			password:        "flag-password",
+			subCommands:     []string{"gtp"},
+		},
+		{
+			name:            "env over default",
+			args:            []string{"--profile", "aistudio"},
+			env:             map[string]string{"IKATAGO_PASSWORD": "env-password"},
+			refreshInterval: 30,
+			username:        "other-user",
+			password:        "env-password",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestConfig(t)
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			opts, subCommands, err := ParseArgs(append([]string{"--config", path}, test.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.RefreshInterval != test.refreshInterval {
+				t.Errorf("refresh interval: got %d, want %d", opts.RefreshInterval, test.refreshInterval)
+			}
+			kataWeight := ""
+			if opts.KataWeight != nil {
+				kataWeight = *opts.KataWeight
+			}
+			if kataWeight != test.kataWeight {
+				t.Errorf("kata weight: got %q, want %q", kataWeight, test.kataWeight)
+			}
+			if opts.Username != test.username {
+				t.Errorf("username: got %q, want %q", opts.Username, test.username)
+			}
+			if opts.Password != test.password {
+				t.Errorf("password: got %q, want %q", opts.Password, test.password)
+			}
+			if len(subCommands) == 0 {
+				subCommands = nil
+			}
+			if !reflect.DeepEqual(subCommands, test.subCommands) {
+				t.Errorf("subcommands: got %v, want %v", subCommands, test.subCommands)
+			}
+		})
+	}
+}
+
+func TestParseArgsWithoutRequiredFlags(t *testing.T) {
+	writeTestConfig(t)
+	// platform, username and password are only required by the commands which login
+	opts, _, err := ParseArgs([]string{"--cmd", "list-platforms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.Platform) != 0 || len(opts.Username) != 0 || len(opts.Password) != 0 {
+		t.Errorf("unexpected login flags: %+v", opts)
+	}
+	if opts.Command != "list-platforms" {
+		t.Errorf("command: got %q", opts.Command)
+	}
+}
+
+func TestParseArgsWithProfile(t *testing.T) {
+	path := writeTestConfig(t)
+	opts, _, err := ParseArgsWithProfile([]string{"--config", path, "--profile", "colab"}, "aistudio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Platform != "aistudio" {
+		t.Errorf("platform: got %q, want aistudio", opts.Platform)
+	}
+}
+
+func TestParseArgsUnknownProfileKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	err := ioutil.WriteFile(path, []byte("profiles:\n  bad:\n    no-such-flag: 1\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ParseArgs([]string{"--config", path, "--profile", "bad"})
+	if err == nil || err.Error() != "unknown_profile_key" {
+		t.Errorf("got %v, want unknown_profile_key", err)
+	}
+}
+
+func TestSetProfileValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `# my ikatago profiles
+default-profile: colab
+profiles:
+  colab:
+    platform: colab # the free gpu
+    kata-override-config: numSearchThreads=8
+  aistudio:
+    platform: aistudio
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProfileValue(path, "colab", "kata-override-config", "numSearchThreads=16,maxVisits=100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProfileValue(path, "new", "kata-weight", "40b"); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range []string{"# my ikatago profiles", "# the free gpu"} {
+		if !strings.Contains(string(written), comment) {
+			t.Errorf("the comment %q is lost: %s", comment, written)
+		}
+	}
+	file, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Profile{
+		"colab":    {"platform": "colab", "kata-override-config": "numSearchThreads=16,maxVisits=100"},
+		"aistudio": {"platform": "aistudio"},
+		"new":      {"kata-weight": "40b"},
+	}
+	if !reflect.DeepEqual(file.Profiles, want) || file.DefaultProfile != "colab" {
+		t.Errorf("got %+v, want %+v", file, want)
+	}
+}
+
+func TestSetProfileValueNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ikatago", "config.yaml")
+	if err := SetProfileValue(path, "colab", "refresh-interval", "50"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := file.Profiles["colab"]["refresh-interval"]; value != "50" {
+		t.Errorf("got %v, want 50", value)
+	}
+}
@@ -0,0 +1,247 @@
+// Package credentials resolves the password without putting it on the command line.
+//
+// The password is resolved in the following order:
+//  1. --password, the IKATAGO_PASSWORD environment variable, or the password / password-env of the profile
+//  2. --password-command, a command which prints the password to stdout, like git credential helpers
+//  3. the credentials file, written by the login command
+//  4. the prompt on the terminal, if stdin is a terminal
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kinfkong/ikatago-client/model"
+	"github.com/kinfkong/ikatago-client/utils"
+	"golang.org/x/term"
+)
+
+const (
+	storeFileName = "credentials"
+	keyFileName   = "credentials.key"
+	keySize       = 32
+)
+
+// Store represents the credentials file.
+// the passwords are encrypted with AES-GCM, but the key is kept next to it in ~/.ikatago, readable only by the owner.
+// so the passwords are not in plain text if only the credentials file is copied or shown, but anyone who can
+// read the files of the user, like the other programs of the user, can decrypt them.
+type Store struct {
+	Dir string
+}
+
+// DefaultStore returns the store in ~/.ikatago
+func DefaultStore() (*Store, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Dir: filepath.Join(home, ".ikatago")}, nil
+}
+
+// Get gets the password of the user on the platform, returns empty string if not found
+func (store *Store) Get(platform string, username string) (string, error) {
+	entries, err := store.load()
+	if err != nil {
+		return "", err
+	}
+	return entries[entryKey(platform, username)], nil
+}
+
+// Set stores the password of the user on the platform
+func (store *Store) Set(platform string, username string, password string) error {
+	entries, err := store.load()
+	if err != nil {
+		return err
+	}
+	entries[entryKey(platform, username)] = password
+	return store.save(entries)
+}
+
+// Delete removes the password of the user on the platform
+func (store *Store) Delete(platform string, username string) error {
+	entries, err := store.load()
+	if err != nil {
+		return err
+	}
+	key := entryKey(platform, username)
+	if _, ok := entries[key]; !ok {
+		return errors.New("credentials_not_found")
+	}
+	delete(entries, key)
+	if len(entries) == 0 {
+		return os.Remove(filepath.Join(store.Dir, storeFileName))
+	}
+	return store.save(entries)
+}
+
+func (store *Store) load() (map[string]string, error) {
+	entries := make(map[string]string)
+	storePath := filepath.Join(store.Dir, storeFileName)
+	if !utils.FileExists(storePath) {
+		return entries, nil
+	}
+	content, err := ioutil.ReadFile(storePath)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := store.cipher(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < gcm.NonceSize() {
+		log.Printf("ERROR credentials file is corrupted: %s\n", storePath)
+		return nil, errors.New("invalid_credentials_file")
+	}
+	plain, err := gcm.Open(nil, content[:gcm.NonceSize()], content[gcm.NonceSize():], nil)
+	if err != nil {
+		log.Printf("ERROR cannot decrypt credentials file: %s\n", storePath)
+		return nil, errors.New("invalid_credentials_file")
+	}
+	err = json.Unmarshal(plain, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (store *Store) save(entries map[string]string) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	gcm, err := store.cipher(true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(store.Dir, storeFileName), gcm.Seal(nonce, nonce, plain, nil), 0600)
+}
+
+func (store *Store) cipher(create bool) (cipher.AEAD, error) {
+	keyPath := filepath.Join(store.Dir, keyFileName)
+	key, err := ioutil.ReadFile(keyPath)
+	if os.IsNotExist(err) && create {
+		key = make([]byte, keySize)
+		_, err = rand.Read(key)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(store.Dir, 0700)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(keyPath, key, 0600)
+	}
+	if err != nil {
+		log.Printf("ERROR cannot read credentials key: %s\n", keyPath)
+		return nil, err
+	}
+	if len(key) != keySize {
+		log.Printf("ERROR credentials key is corrupted: %s\n", keyPath)
+		return nil, errors.New("invalid_credentials_key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func entryKey(platform string, username string) string {
+	return platform + "/" + username
+}
+
+// Resolve resolves the password of the options if it is not given. the terminal prompt is only used when interactive is true.
+func Resolve(opts *model.AllOpts, interactive bool) error {
+	if len(opts.Password) > 0 {
+		return nil
+	}
+	if opts.PasswordCommand != nil && len(*opts.PasswordCommand) > 0 {
+		password, err := RunPasswordCommand(*opts.PasswordCommand)
+		if err != nil {
+			return err
+		}
+		opts.Password = password
+		return nil
+	}
+	if len(opts.Platform) > 0 && len(opts.Username) > 0 {
+		store, err := DefaultStore()
+		if err == nil {
+			password, err := store.Get(opts.Platform, opts.Username)
+			if err != nil {
+				log.Printf("ERROR cannot read the credentials file: %v\n", err)
+			}
+			if len(password) > 0 {
+				opts.Password = password
+				return nil
+			}
+		}
+	}
+	if interactive && term.IsTerminal(int(os.Stdin.Fd())) {
+		password, err := Prompt(os.Stdin, os.Stderr, fmt.Sprintf("Password for %s on %s: ", opts.Username, opts.Platform))
+		if err != nil {
+			return err
+		}
+		opts.Password = password
+	}
+	return nil
+}
+
+// RunPasswordCommand runs the command and returns the first line of its output as the password
+func RunPasswordCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("ERROR password command failed: %v\n", err)
+		return "", errors.New("password_command_failed")
+	}
+	password := strings.TrimRight(strings.SplitN(string(output), "\n", 2)[0], "\r")
+	if len(password) == 0 {
+		return "", errors.New("empty_password")
+	}
+	return password, nil
+}
+
+// Prompt reads the password from the reader. the input is not echoed if the reader is a terminal.
+func Prompt(reader *os.File, promptWriter io.Writer, prompt string) (string, error) {
+	fmt.Fprint(promptWriter, prompt)
+	if term.IsTerminal(int(reader.Fd())) {
+		password, err := term.ReadPassword(int(reader.Fd()))
+		fmt.Fprintln(promptWriter)
+		if err != nil {
+			return "", err
+		}
+		return string(password), nil
+	}
+	line, err := bufio.NewReader(reader).ReadBytes('\n')
+	fmt.Fprintln(promptWriter)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(bytes.TrimRight(line, "\r\n")), nil
+}
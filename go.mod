@@ -5,6 +5,8 @@ go 1.20
 require (
 	github.com/jessevdk/go-flags v1.4.0
 	golang.org/x/crypto v0.13.0
+	golang.org/x/term v0.12.0
+	gopkg.in/yaml.v3 v3.0.1
 	moul.io/http2curl/v2 v2.3.0
 )
 
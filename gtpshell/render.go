@@ -0,0 +1,186 @@
+package gtpshell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxAnalysisMoves is the number of candidate moves rendered for each analysis update
+const maxAnalysisMoves = 5
+
+// analyzeCommands stream the info lines after the first line of the response
+var analyzeCommands = map[string]bool{
+	"kata-analyze":         true,
+	"lz-analyze":           true,
+	"kata-genmove_analyze": true,
+	"lz-genmove_analyze":   true,
+}
+
+// moveInfo is a candidate move of the analysis
+type moveInfo struct {
+	move      string
+	visits    int
+	winrate   float64
+	scoreLead float64
+	hasScore  bool
+	order     int
+	pv        []string
+}
+
+// display reads the gtp responses of katago and renders them until the output is closed
+func (shell *Shell) display(reader io.Reader) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var command pendingCommand
+	response := make([]string, 0)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(response) == 0 {
+			if len(line) == 0 {
+				continue
+			}
+			command = shell.nextPending()
+		}
+		if len(line) == 0 {
+			shell.finish(command, response)
+			response = response[:0]
+			continue
+		}
+		if analyzeCommands[command.name] && strings.HasPrefix(line, "info ") {
+			shell.renderAnalysis(command.name, line)
+			continue
+		}
+		if len(response) == 0 && analyzeCommands[command.name] {
+			// the analysis keeps running, so the first line is shown at once
+			shell.renderStatus(line)
+		}
+		response = append(response, line)
+	}
+	if len(response) > 0 {
+		shell.finish(command, response)
+	}
+}
+
+// finish renders a complete response
+func (shell *Shell) finish(command pendingCommand, response []string) {
+	if command.name == "list_commands" && command.hidden {
+		if strings.HasPrefix(response[0], "=") {
+			commands := []string{strings.TrimSpace(strings.TrimLeft(response[0], "=0123456789"))}
+			commands = append(commands, response[1:]...)
+			shell.lock.Lock()
+			shell.commands = commands
+			shell.lock.Unlock()
+		}
+		return
+	}
+	if analyzeCommands[command.name] {
+		response = response[1:]
+		if len(response) == 0 {
+			return
+		}
+		shell.printf("%s\n", strings.Join(response, "\n"))
+		return
+	}
+	shell.renderStatus(response[0])
+	if len(response) > 1 {
+		shell.printf("%s\n", strings.Join(response[1:], "\n"))
+	}
+}
+
+// renderStatus renders the first line of a response, green for success and red for failure
+func (shell *Shell) renderStatus(line string) {
+	color := shell.colors.Green
+	if strings.HasPrefix(line, "?") {
+		color = shell.colors.Red
+	}
+	shell.printf("%s%s%s\n", color, line, shell.colors.Reset)
+}
+
+// renderAnalysis renders the best candidate moves of an analysis line of the command
+func (shell *Shell) renderAnalysis(command string, line string) {
+	moves := parseAnalysis(command, line)
+	if len(moves) == 0 {
+		return
+	}
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "%s%-5s %8s %8s %7s  %s%s\n", shell.colors.Cyan, "move", "visits", "winrate", "score", "pv", shell.colors.Reset)
+	for i, move := range moves {
+		if i >= maxAnalysisMoves {
+			break
+		}
+		score := ""
+		if move.hasScore {
+			score = fmt.Sprintf("%+.1f", move.scoreLead)
+		}
+		pv := move.pv
+		if len(pv) > 8 {
+			pv = pv[:8]
+		}
+		fmt.Fprintf(builder, "%-5s %8d %7.1f%% %7s  %s\n", move.move, move.visits, move.winrate, score, strings.Join(pv, " "))
+	}
+	shell.printf("%s", builder.String())
+}
+
+// parseAnalysis parses the info line of the analyze command, like kata-analyze or lz-analyze, ordered by the order
+// of the engine. the winrate is in percent.
+func parseAnalysis(command string, line string) []moveInfo {
+	// kata- commands report the winrate in [0, 1], lz- commands in 1/10000
+	winrateScale := 100.0
+	if strings.HasPrefix(command, "lz-") {
+		winrateScale = 0.01
+	}
+	moves := make([]moveInfo, 0)
+	for _, part := range strings.Split(line, "info ") {
+		fields := strings.Fields(part)
+		if len(fields) < 2 {
+			continue
+		}
+		move := moveInfo{order: len(moves)}
+		for i := 0; i+1 < len(fields); i += 2 {
+			key := fields[i]
+			value := fields[i+1]
+			if key == "pv" {
+				move.pv = pvOf(fields[i+1:])
+				break
+			}
+			switch key {
+			case "move":
+				move.move = value
+			case "visits":
+				move.visits, _ = strconv.Atoi(value)
+			case "winrate":
+				move.winrate, _ = strconv.ParseFloat(value, 64)
+			case "scoreLead":
+				move.scoreLead, _ = strconv.ParseFloat(value, 64)
+				move.hasScore = true
+			case "order":
+				move.order, _ = strconv.Atoi(value)
+			}
+		}
+		if len(move.move) == 0 {
+			continue
+		}
+		move.winrate = move.winrate * winrateScale
+		moves = append(moves, move)
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return moves[i].order < moves[j].order
+	})
+	return moves
+}
+
+// pvOf returns the moves of the pv, which ends at the next key like ownership
+func pvOf(fields []string) []string {
+	pv := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field == "ownership" || field == "ownershipStdev" || field == "movesOwnership" || field == "pvVisits" || field == "pvEdgeVisits" {
+			break
+		}
+		pv = append(pv, field)
+	}
+	return pv
+}
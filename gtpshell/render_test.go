@@ -0,0 +1,131 @@
+package gtpshell
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/term"
+)
+
+func newTestShell(out *bytes.Buffer) *Shell {
+	return &Shell{out: out, colors: &term.EscapeCodes{}, autoBoard: true}
+}
+
+func TestParseAnalysis(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		line    string
+		want    []moveInfo
+	}{
+		{
+			name:    "kata-analyze",
+			command: "kata-analyze",
+			line:    "info move Q16 visits 5 utility 0.1 winrate 0.5 scoreMean 0.3 scoreLead 0.25 order 1 pv Q16 D4 info move D4 visits 10 winrate 0.625 scoreLead -1.5 order 0 pv D4 Q16 R4 ownership 0.1 0.2",
+			want: []moveInfo{
+				{move: "D4", visits: 10, winrate: 62.5, scoreLead: -1.5, hasScore: true, order: 0, pv: []string{"D4", "Q16", "R4"}},
+				{move: "Q16", visits: 5, winrate: 50, scoreLead: 0.25, hasScore: true, order: 1, pv: []string{"Q16", "D4"}},
+			},
+		},
+		{
+			name:    "lz-analyze",
+			command: "lz-analyze",
+			line:    "info move D4 visits 120 winrate 5230 prior 1000 lcb 5100 order 0 pv D4 Q16 info move A1 visits 1 winrate 1 order 1 pv A1",
+			want: []moveInfo{
+				{move: "D4", visits: 120, winrate: 52.3, order: 0, pv: []string{"D4", "Q16"}},
+				{move: "A1", visits: 1, winrate: 0.01, order: 1, pv: []string{"A1"}},
+			},
+		},
+		{
+			name:    "kata-analyze winrate of 1",
+			command: "kata-genmove_analyze",
+			line:    "info move D4 visits 3 winrate 1 order 0 pv D4",
+			want:    []moveInfo{{move: "D4", visits: 3, winrate: 100, order: 0, pv: []string{"D4"}}},
+		},
+		{
+			name:    "no moves",
+			command: "kata-analyze",
+			line:    "info visits 3",
+			want:    []moveInfo{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseAnalysis(test.command, test.line)
+			for i := range got {
+				// 0.523 * 100 is not exact
+				got[i].winrate = float64(int(got[i].winrate*1000+0.5)) / 1000
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	out := &bytes.Buffer{}
+	shell := newTestShell(out)
+	shell.pending = []pendingCommand{{name: "list_commands", hidden: true}, {name: "kata-analyze"}, {name: "version"}, {name: "foo"}}
+	output := "= protocol_version\nversion\nkata-analyze\nshowboard\n\n" +
+		"=\ninfo move D4 visits 10 winrate 0.625 scoreLead 1.5 order 0 pv D4 Q16\r\n\n" +
+		"= 1.12.0\n\n" +
+		"? unknown command\n\n"
+	shell.display(strings.NewReader(output))
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	want := [][]string{
+		{"="},
+		{"move", "visits", "winrate", "score", "pv"},
+		{"D4", "10", "62.5%", "+1.5", "D4", "Q16"},
+		{"=", "1.12.0"},
+		{"?", "unknown", "command"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %q", out.String())
+	}
+	for i, line := range lines {
+		if fields := strings.Fields(line); !reflect.DeepEqual(fields, want[i]) {
+			t.Errorf("line %d: got %q, want %q", i, fields, want[i])
+		}
+	}
+	if want := []string{"protocol_version", "version", "kata-analyze", "showboard"}; !reflect.DeepEqual(shell.commands, want) {
+		t.Errorf("the commands of list_commands: got %q, want %q", shell.commands, want)
+	}
+	if !shell.supports("showboard") || shell.supports("genmove") {
+		t.Error("supports does not follow list_commands")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	out := &bytes.Buffer{}
+	shell := newTestShell(out)
+	shell.commands = []string{"kata-analyze", "kata-genmove_analyze", "komi", "version"}
+	tests := []struct {
+		line    string
+		pos     int
+		key     rune
+		newLine string
+		newPos  int
+		ok      bool
+	}{
+		{line: "ver", pos: 3, key: '\t', newLine: "version ", newPos: 8, ok: true},
+		{line: "kat", pos: 3, key: '\t', newLine: "kata-", newPos: 5, ok: true},
+		{line: ":q", pos: 2, key: '\t', newLine: ":quit ", newPos: 6, ok: true},
+		{line: "ver", pos: 3, key: 'x'},
+		{line: "komi 7", pos: 6, key: '\t'},
+		{line: "zzz", pos: 3, key: '\t'},
+	}
+	for _, test := range tests {
+		newLine, newPos, ok := shell.complete(test.line, test.pos, test.key)
+		if newLine != test.newLine || newPos != test.newPos || ok != test.ok {
+			t.Errorf("complete(%q): got %q %d %v, want %q %d %v", test.line, newLine, newPos, ok, test.newLine, test.newPos, test.ok)
+		}
+	}
+	// the matches without a longer common prefix are listed
+	if _, _, ok := shell.complete("k", 1, '\t'); ok || !strings.Contains(out.String(), "kata-analyze  kata-genmove_analyze  komi") {
+		t.Errorf("got %v, output %q", ok, out.String())
+	}
+}
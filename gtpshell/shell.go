@@ -0,0 +1,289 @@
+// Package gtpshell implements an interactive gtp shell on top of the remote katago session.
+package gtpshell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/client"
+	"golang.org/x/term"
+)
+
+const prompt = "gtp> "
+
+// positionCommands are the gtp commands which change the position, the board is shown after them
+var positionCommands = map[string]bool{
+	"play":                 true,
+	"genmove":              true,
+	"undo":                 true,
+	"clear_board":          true,
+	"boardsize":            true,
+	"loadsgf":              true,
+	"set_position":         true,
+	"fixed_handicap":       true,
+	"place_free_handicap":  true,
+	"set_free_handicap":    true,
+	"kata-genmove_analyze": true,
+	"lz-genmove_analyze":   true,
+}
+
+// metaCommands are handled by the shell itself
+var metaCommands = []string{":help", ":board", ":quit"}
+
+type pendingCommand struct {
+	name   string
+	hidden bool
+}
+
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+type plainReader struct {
+	reader *bufio.Reader
+}
+
+func (r *plainReader) ReadLine() (string, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Shell is the interactive gtp shell
+type Shell struct {
+	client      *client.Client
+	options     client.RunKatagoOptions
+	subCommands []string
+
+	in        io.Reader
+	out       io.Writer
+	colors    *term.EscapeCodes
+	lock      sync.Mutex
+	commands  []string
+	pending   []pendingCommand
+	autoBoard bool
+}
+
+// New creates the shell reading the commands from in and writing to out, the katago session is started by Run
+func New(remoteClient *client.Client, options client.RunKatagoOptions, subCommands []string, in io.Reader, out io.Writer) *Shell {
+	return &Shell{
+		client:      remoteClient,
+		options:     options,
+		subCommands: subCommands,
+		in:          in,
+		out:         out,
+		colors:      &term.EscapeCodes{},
+		autoBoard:   true,
+	}
+}
+
+// terminalFd returns the fd of the input if both the input and the output are the terminal
+func terminalFd(in io.Reader, out io.Writer) (int, bool) {
+	inFile, ok := in.(*os.File)
+	if !ok || !term.IsTerminal(int(inFile.Fd())) {
+		return 0, false
+	}
+	outFile, ok := out.(*os.File)
+	if !ok || !term.IsTerminal(int(outFile.Fd())) {
+		return 0, false
+	}
+	return int(inFile.Fd()), true
+}
+
+// Run starts katago, and reads the gtp commands from the input until quit or the end of the input.
+// the terminal is put in raw mode only if the input and the output are the terminal.
+func (shell *Shell) Run() error {
+	var reader lineReader
+	if fd, ok := terminalFd(shell.in, shell.out); ok {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+		terminal := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{shell.in, shell.out}, prompt)
+		if width, height, err := term.GetSize(fd); err == nil {
+			terminal.SetSize(width, height)
+		}
+		terminal.AutoCompleteCallback = shell.complete
+		shell.out = terminal
+		shell.colors = terminal.Escape
+		reader = terminal
+	} else {
+		reader = &plainReader{reader: bufio.NewReader(shell.in)}
+	}
+
+	inputReader, inputWriter := io.Pipe()
+	outputReader, outputWriter := io.Pipe()
+	result, err := shell.client.RunKatago(shell.options, shell.subCommands, inputReader, outputWriter, shell.out, nil)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-result.Done()
+		inputReader.CloseWithError(errors.New("engine_exited"))
+		outputWriter.Close()
+	}()
+	displayDone := make(chan struct{})
+	go func() {
+		defer close(displayDone)
+		shell.display(outputReader)
+	}()
+
+	shell.send(inputWriter, "list_commands", true)
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			shell.send(inputWriter, "quit", false)
+			break
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if line == "exit" || line == ":quit" {
+			line = "quit"
+		}
+		if strings.HasPrefix(line, ":") {
+			shell.runMeta(line)
+			continue
+		}
+		if shell.send(inputWriter, line, false) != nil {
+			break
+		}
+		name := client.GTPCommandName(line)
+		if name == "quit" {
+			break
+		}
+		if shell.autoBoard && positionCommands[name] && shell.supports("showboard") {
+			shell.send(inputWriter, "showboard", false)
+		}
+	}
+	inputWriter.Close()
+	select {
+	case <-displayDone:
+	case <-time.After(5 * time.Second):
+		result.Stop()
+		<-displayDone
+	}
+	result.Wait()
+	return result.Err
+}
+
+// send sends the command to katago, and remembers it so that the response can be rendered
+func (shell *Shell) send(w io.Writer, line string, hidden bool) error {
+	shell.lock.Lock()
+	shell.pending = append(shell.pending, pendingCommand{name: client.GTPCommandName(line), hidden: hidden})
+	shell.lock.Unlock()
+	_, err := io.WriteString(w, line+"\n")
+	if err != nil {
+		shell.printf("%sthe engine has exited%s\n", shell.colors.Red, shell.colors.Reset)
+	}
+	return err
+}
+
+func (shell *Shell) runMeta(line string) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":board":
+		if len(fields) > 1 {
+			shell.autoBoard = fields[1] == "on"
+		}
+		status := "off"
+		if shell.autoBoard {
+			status = "on"
+		}
+		shell.printf("showing the board after the moves: %s\n", status)
+	case ":help":
+		shell.printf("type the gtp commands, tab completes the command names.\n")
+		shell.printf("  :board on|off  shows the board after the moves\n")
+		shell.printf("  :quit, exit    quits katago and the shell\n")
+	default:
+		shell.printf("%sunknown shell command: %s%s\n", shell.colors.Red, fields[0], shell.colors.Reset)
+	}
+}
+
+// complete completes the command names with tab
+func (shell *Shell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || strings.Contains(line[:pos], " ") {
+		return "", 0, false
+	}
+	prefix := line[:pos]
+	shell.lock.Lock()
+	candidates := append(append([]string{}, shell.commands...), metaCommands...)
+	shell.lock.Unlock()
+	matches := make([]string, 0)
+	for _, command := range candidates {
+		if strings.HasPrefix(command, prefix) {
+			matches = append(matches, command)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	if len(matches) == 1 {
+		completed := matches[0] + " "
+		return completed + strings.TrimLeft(line[pos:], " "), len(completed), true
+	}
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) > len(prefix) {
+		return common + line[pos:], len(common), true
+	}
+	sort.Strings(matches)
+	shell.printf("%s\n", strings.Join(matches, "  "))
+	return "", 0, false
+}
+
+func (shell *Shell) supports(command string) bool {
+	shell.lock.Lock()
+	defer shell.lock.Unlock()
+	for _, c := range shell.commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// nextPending pops the command whose response is starting
+func (shell *Shell) nextPending() pendingCommand {
+	shell.lock.Lock()
+	defer shell.lock.Unlock()
+	if len(shell.pending) == 0 {
+		return pendingCommand{}
+	}
+	command := shell.pending[0]
+	shell.pending = shell.pending[1:]
+	return command
+}
+
+func (shell *Shell) printf(format string, args ...interface{}) {
+	fmt.Fprintf(shell.out, format, args...)
+}
+
+func init() {
+	client.RegisterCommand(&client.Command{
+		Name:        "shell",
+		Description: "Runs an interactive gtp shell with completion and the board",
+		Login:       true,
+		Run: func(ctx *client.CommandContext) error {
+			return New(ctx.Client, ctx.Options, ctx.SubCommands, ctx.Stdin, ctx.Stdout).Run()
+		},
+	})
+}
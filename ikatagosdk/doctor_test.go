@@ -0,0 +1,112 @@
+package ikatagosdk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kinfkong/ikatago-client/client"
+)
+
+// doctorResults returns the names and the results of the steps
+func doctorResults(report *client.DoctorReport) ([]string, []string) {
+	names := make([]string, 0)
+	results := make([]string, 0)
+	for _, step := range report.Steps {
+		names = append(names, step.Name)
+		if step.Skipped {
+			results = append(results, "skipped")
+		} else if step.OK {
+			results = append(results, "ok")
+		} else {
+			results = append(results, "failed")
+		}
+	}
+	return names, results
+}
+
+var doctorSteps = []string{
+	client.DoctorStepWorld,
+	client.DoctorStepPlatform,
+	client.DoctorStepSSHInfo,
+	client.DoctorStepDNS,
+	client.DoctorStepTCP,
+	client.DoctorStepSSHHandshake,
+	client.DoctorStepSSHAuth,
+	client.DoctorStepRemoteCommand,
+	client.DoctorStepConfigUpload,
+	client.DoctorStepGTP,
+}
+
+func TestDoctor(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := newFakeServer(t)
+	config := filepath.Join(t.TempDir(), "gtp.cfg")
+	if err := ioutil.WriteFile(config, []byte("numSearchThreads = 8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		platform string
+		password string
+		config   *string
+		results  []string
+	}{
+		{
+			name:     "ok",
+			platform: fakePlatform,
+			password: fakePassword,
+			config:   &config,
+			results:  []string{"ok", "ok", "ok", "ok", "ok", "ok", "ok", "ok", "ok", "ok"},
+		},
+		{
+			name:     "no local config",
+			platform: fakePlatform,
+			password: fakePassword,
+			results:  []string{"ok", "ok", "ok", "ok", "ok", "ok", "ok", "ok", "skipped", "ok"},
+		},
+		{
+			name:     "wrong password",
+			platform: fakePlatform,
+			password: "wrong",
+			config:   &config,
+			results:  []string{"ok", "ok", "ok", "ok", "ok", "ok", "failed", "skipped", "skipped", "skipped"},
+		},
+		{
+			name:     "unknown platform",
+			platform: "unknown",
+			password: fakePassword,
+			config:   &config,
+			results:  []string{"ok", "failed", "skipped", "skipped", "skipped", "skipped", "skipped", "skipped", "skipped", "skipped"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := NewClient(server.world.URL+"/world.json", test.platform, fakeUser, test.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			report := c.remoteClient.Doctor(client.RunKatagoOptions{NoCompress: true, KataLocalConfig: test.config}, nil)
+			names, results := doctorResults(report)
+			if !reflect.DeepEqual(names, doctorSteps) {
+				t.Errorf("got steps %q, want %q", names, doctorSteps)
+			}
+			if !reflect.DeepEqual(results, test.results) {
+				t.Errorf("got results %q, want %q, report %+v", results, test.results, report.Steps)
+			}
+			if ok := test.results[len(test.results)-1] == "ok"; report.OK != ok {
+				t.Errorf("got report ok %v, want %v", report.OK, ok)
+			}
+			for _, step := range report.Steps {
+				if !step.OK && !step.Skipped && len(step.Advice) == 0 {
+					t.Errorf("the failed step %s has no advice", step.Name)
+				}
+			}
+		})
+	}
+	if report := server.newClient(t).remoteClient.Doctor(client.RunKatagoOptions{NoCompress: true}, nil); report.Steps[len(report.Steps)-1].Detail != "katago 1.12.0" {
+		t.Errorf("got gtp detail %q", report.Steps[len(report.Steps)-1].Detail)
+	}
+}
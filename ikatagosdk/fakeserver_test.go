@@ -0,0 +1,258 @@
+package ikatagosdk
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	fakePlatform = "fake"
+	fakeUser     = "foo"
+	fakePassword = "secret"
+	// fakeServerInfo is the output of query-server
+	fakeServerInfo = `{"gpuTypes":["1x","2x"],"weights":["20b","40b","60b"]}`
+)
+
+// fakeServer is an in-process world and ssh server, which runs a fake katago answering the gtp commands
+type fakeServer struct {
+	world    *httptest.Server
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	// legacy means the server does not support preloading katago
+	legacy bool
+
+	lock     sync.Mutex
+	commands []string
+	// configs are the uploaded configs by name
+	configs map[string]string
+	// rejectSessions is the number of the next sessions to be rejected, like the server is busy
+	rejectSessions int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeServer{
+		configs: make(map[string]string),
+		config: &ssh.ServerConfig{
+			PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+				if conn.User() == fakeUser && string(password) == fakePassword {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("password rejected for %s", conn.User())
+			},
+		},
+	}
+	server.config.AddHostKey(signer)
+	server.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.serve()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/world.json", func(w http.ResponseWriter, r *http.Request) {
+		getURL := server.world.URL
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"platforms": []interface{}{
+				map[string]interface{}{
+					"name": fakePlatform,
+					"oss":  map[string]interface{}{},
+					"http": map[string]interface{}{"getUrl": getURL},
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/users/"+fakeUser+".ssh.json", func(w http.ResponseWriter, r *http.Request) {
+		addr := server.listener.Addr().(*net.TCPAddr)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"host": addr.IP.String(),
+			"port": addr.Port,
+			"user": fakeUser,
+		})
+	})
+	server.world = httptest.NewServer(mux)
+
+	t.Cleanup(func() {
+		server.world.Close()
+		server.listener.Close()
+	})
+	return server
+}
+
+// newClient creates the sdk client of the fake server
+func (server *fakeServer) newClient(t *testing.T) *Client {
+	c, err := NewClient(server.world.URL+"/world.json", fakePlatform, fakeUser, fakePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// RejectSessions rejects the next n sessions
+func (server *fakeServer) RejectSessions(n int) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.rejectSessions = n
+}
+
+// Commands returns the commands executed on the server so far
+func (server *fakeServer) Commands() []string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]string{}, server.commands...)
+}
+
+func (server *fakeServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handleConn(conn)
+	}
+}
+
+func (server *fakeServer) handleConn(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, server.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		server.lock.Lock()
+		reject := server.rejectSessions > 0
+		if reject {
+			server.rejectSessions--
+		}
+		server.lock.Unlock()
+		if reject {
+			newChannel.Reject(ssh.ResourceShortage, "too many sessions")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go server.handleSession(channel, requests)
+	}
+}
+
+func (server *fakeServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			// like the keepalive requests
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+			continue
+		}
+		if len(req.Payload) < 4 {
+			req.Reply(false, nil)
+			continue
+		}
+		cmd := string(req.Payload[4 : 4+binary.BigEndian.Uint32(req.Payload)])
+		req.Reply(true, nil)
+		server.lock.Lock()
+		server.commands = append(server.commands, cmd)
+		server.lock.Unlock()
+		go ssh.DiscardRequests(requests)
+		if strings.HasPrefix(cmd, "scp-config ") {
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{server.receiveConfig(channel, cmd)}))
+			return
+		}
+		if strings.HasPrefix(cmd, "query-server") {
+			fmt.Fprintf(channel, "%s\n", fakeServerInfo)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+		}
+		status := runFakeKatago(channel, cmd, server.legacy)
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// receiveConfig stores the config uploaded by scp-config, and echoes its sha256
+func (server *fakeServer) receiveConfig(channel ssh.Channel, cmd string) uint32 {
+	content, err := ioutil.ReadAll(channel)
+	if err != nil {
+		return 1
+	}
+	checksum := sha256.Sum256(content)
+	server.lock.Lock()
+	server.configs[strings.Fields(cmd)[1]] = string(content)
+	server.lock.Unlock()
+	fmt.Fprintf(channel, "%s\n", hex.EncodeToString(checksum[:]))
+	return 0
+}
+
+// Config returns the uploaded config by name
+func (server *fakeServer) Config(name string) (string, bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	content, ok := server.configs[name]
+	return content, ok
+}
+
+// runFakeKatago answers the gtp commands until quit or the input is closed, returns the exit status
+func runFakeKatago(channel ssh.Channel, cmd string, legacy bool) uint32 {
+	if !strings.HasPrefix(cmd, "run-katago") && (legacy || !strings.HasPrefix(cmd, "preload-katago")) {
+		fmt.Fprintf(channel.Stderr(), "unknown command\n")
+		return 127
+	}
+	if legacy && strings.Contains(cmd, "--attach") {
+		fmt.Fprintf(channel.Stderr(), "unknown flag `attach'\n")
+		return 1
+	}
+	fmt.Fprintf(channel.Stderr(), "GTP ready, beginning main protocol loop\n")
+	scanner := bufio.NewScanner(channel)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "version":
+			fmt.Fprintf(channel, "= 1.12.0\n\n")
+		case "name":
+			fmt.Fprintf(channel, "= KataGo\n\n")
+		case "quit":
+			fmt.Fprintf(channel, "=\n\n")
+			return 0
+		case "die":
+			// like katago crashes
+			return 3
+		default:
+			fmt.Fprintf(channel, "? unknown command\n\n")
+		}
+	}
+	return 0
+}
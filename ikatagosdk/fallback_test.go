@@ -0,0 +1,37 @@
+package ikatagosdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunnerStopWithFallback(t *testing.T) {
+	server := newFakeServer(t)
+	runner := newTestRunner(t, server)
+	// the fallback needs the decoded output
+	runner.SetUseRawData(false)
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "started")
+	script := filepath.Join(dir, "katago")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\ntouch "+marker+"\ncat > /dev/null\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner.SetFallbackKatago(script)
+
+	callback := newTestCallback()
+	result := runAsync(runner, callback)
+	callback.waitReady(t)
+	if err := runner.SendGTPCommand("version"); err != nil {
+		t.Fatal(err)
+	}
+	callback.waitOutput(t, "= 1.12.0")
+	runner.Stop()
+	if err := waitRun(t, result); err != nil {
+		t.Errorf("Run stopped by Stop: got %v, want nil", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the fallback katago is started after Stop")
+	}
+}
@@ -0,0 +1,138 @@
+package ikatagosdk
+
+import (
+	"bytes"
+	"strings"
+)
+
+// the framing modes of the output delivered to the LineCallback
+const (
+	// FramingLine delivers every complete line to OnLine
+	FramingLine = iota + 1
+	// FramingGTPResponse delivers every complete gtp response to OnGTPResponse. the streaming analysis lines,
+	// and the lines outside a response, like the ending of kata-analyze, are delivered to OnLine
+	FramingGTPResponse
+)
+
+const defaultFramingBufferSize = 256
+
+// LineCallback receives the framed output of katago
+type LineCallback interface {
+	// OnLine is called with a complete line, without the line ending
+	OnLine(line string)
+	// OnGTPResponse is called with a complete gtp response. id is empty if the command has no id.
+	// response is the content after the =/? and the id, without the ending empty line.
+	OnGTPResponse(id string, success bool, response string)
+}
+
+// lineFramer splits the output into lines, and delivers them to the callback in its own goroutine.
+// at most bufferSize lines are queued, the writer blocks if the callback is slower than the output.
+type lineFramer struct {
+	callback LineCallback
+	framing  int
+	pending  []byte
+	lines    chan string
+	finished chan struct{}
+
+	// the gtp response being assembled
+	inResponse bool
+	id         string
+	success    bool
+	response   []string
+}
+
+func newLineFramer(callback LineCallback, framing int, bufferSize int) *lineFramer {
+	if bufferSize <= 0 {
+		bufferSize = defaultFramingBufferSize
+	}
+	framer := &lineFramer{
+		callback: callback,
+		framing:  framing,
+		lines:    make(chan string, bufferSize),
+		finished: make(chan struct{}),
+	}
+	go framer.deliver()
+	return framer
+}
+
+func (framer *lineFramer) Write(p []byte) (int, error) {
+	framer.pending = append(framer.pending, p...)
+	for {
+		idx := bytes.IndexByte(framer.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(framer.pending[:idx]), "\r")
+		framer.pending = framer.pending[idx+1:]
+		framer.lines <- line
+	}
+	return len(p), nil
+}
+
+// Close flushes the incomplete line, and waits until all the lines are delivered
+func (framer *lineFramer) Close() error {
+	if len(framer.pending) > 0 {
+		framer.lines <- string(framer.pending)
+		framer.pending = nil
+	}
+	close(framer.lines)
+	<-framer.finished
+	return nil
+}
+
+func (framer *lineFramer) deliver() {
+	defer close(framer.finished)
+	for line := range framer.lines {
+		if framer.framing == FramingLine {
+			framer.callback.OnLine(line)
+			continue
+		}
+		framer.onGTPLine(line)
+	}
+	if framer.inResponse {
+		framer.finishResponse()
+	}
+}
+
+func (framer *lineFramer) onGTPLine(line string) {
+	if !framer.inResponse {
+		if len(line) == 0 {
+			// the empty line between the responses
+			return
+		}
+		if line[0] != '=' && line[0] != '?' {
+			framer.callback.OnLine(line)
+			return
+		}
+		rest := line[1:]
+		idLength := 0
+		for idLength < len(rest) && rest[idLength] >= '0' && rest[idLength] <= '9' {
+			idLength++
+		}
+		framer.inResponse = true
+		framer.id = rest[:idLength]
+		framer.success = line[0] == '='
+		framer.response = []string{strings.TrimSpace(rest[idLength:])}
+		return
+	}
+	if len(line) == 0 {
+		framer.finishResponse()
+		return
+	}
+	if strings.HasPrefix(line, "info ") {
+		// the streaming analysis of kata-analyze / lz-analyze never ends until the next command
+		framer.callback.OnLine(line)
+		return
+	}
+	framer.response = append(framer.response, line)
+}
+
+func (framer *lineFramer) finishResponse() {
+	framer.inResponse = false
+	response := strings.Join(framer.response, "\n")
+	if framer.response[0] == "" {
+		response = strings.Join(framer.response[1:], "\n")
+	}
+	framer.callback.OnGTPResponse(framer.id, framer.success, response)
+	framer.response = nil
+}
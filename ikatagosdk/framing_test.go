@@ -0,0 +1,40 @@
+package ikatagosdk
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type testLineCallback struct {
+	events []string
+}
+
+func (callback *testLineCallback) OnLine(line string) {
+	callback.events = append(callback.events, "line: "+line)
+}
+
+func (callback *testLineCallback) OnGTPResponse(id string, success bool, response string) {
+	callback.events = append(callback.events, fmt.Sprintf("response %s %v: %s", id, success, response))
+}
+
+func TestLineFramerGTPResponse(t *testing.T) {
+	callback := &testLineCallback{}
+	framer := newLineFramer(callback, FramingGTPResponse, 0)
+	framer.Write([]byte("=1 1.12.0\n\n= \ninfo move D4 visits 10\n"))
+	framer.Write([]byte("info move Q16 visits 20\n\ninfo move D4 visits 30\n\n?2 unknown"))
+	framer.Write([]byte(" command\n\n"))
+	framer.Close()
+	want := []string{
+		"response 1 true: 1.12.0",
+		"line: info move D4 visits 10",
+		"line: info move Q16 visits 20",
+		"response  true: ",
+		// the last analysis line after the empty line is outside a response
+		"line: info move D4 visits 30",
+		"response 2 false: unknown command",
+	}
+	if !reflect.DeepEqual(callback.events, want) {
+		t.Errorf("got %q, want %q", callback.events, want)
+	}
+}
@@ -2,34 +2,43 @@ package ikatagosdk
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"os"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/kinfkong/ikatago-client/client"
+	"github.com/kinfkong/ikatago-client/config"
+	"github.com/kinfkong/ikatago-client/credentials"
+	"github.com/kinfkong/ikatago-client/metrics"
 	"github.com/kinfkong/ikatago-client/model"
+	"github.com/kinfkong/ikatago-client/tracing"
 	"github.com/kinfkong/ikatago-client/utils"
 )
 
 type genericOptions struct {
-	NoCompress         *bool   `long:"no-compress" description:"compress the data during transmission"`
-	RefreshInterval    *int    `long:"refresh-interval" description:"sets the refresh interval in cent seconds"`
-	TransmitMoveNum    *int    `long:"transmit-move-num" description:"limits number of moves when transmission during analyze"`
-	KataLocalConfig    *string `long:"kata-local-config" description:"The katago config file. like, gtp_example.cfg"`
-	KataOverrideConfig *string `long:"kata-override-config" description:"The katago override-config, like: analysisPVLen=30,numSearchThreads=30"`
-	KataName           *string `long:"kata-name" description:"The katago binary name"`
-	KataWeight         *string `long:"kata-weight" description:"The katago weight name"`
-	KataConfig         *string `long:"kata-config" description:"The katago config name"`
-	EngineType         *string `long:"engine-type" description:"sets the enginetype"`
-	ForceNode          *string `long:"force-node" description:"in cluster, force to a specific node."`
-	Token              *string `long:"token" description:"sets the token"`
-	GpuType            *string `long:"gpu-type" description:"sets the gpu type"`
-	ExtraInfo          *string `long:"extra-info" description:"sets the extra info of the command"`
-	ClientID           *string `long:"client-id" description:"sets the client id"`
-	Command            string  `long:"cmd" description:"The command to run the katago" default:"run-katago"`
+	NoCompress         *bool   `long:"no-compress" env:"IKATAGO_NO_COMPRESS" description:"compress the data during transmission"`
+	RefreshInterval    *int    `long:"refresh-interval" env:"IKATAGO_REFRESH_INTERVAL" description:"sets the refresh interval in cent seconds"`
+	TransmitMoveNum    *int    `long:"transmit-move-num" env:"IKATAGO_TRANSMIT_MOVE_NUM" description:"limits number of moves when transmission during analyze"`
+	KataLocalConfig    *string `long:"kata-local-config" env:"IKATAGO_KATA_LOCAL_CONFIG" description:"The katago config file. like, gtp_example.cfg"`
+	KataOverrideConfig *string `long:"kata-override-config" env:"IKATAGO_KATA_OVERRIDE_CONFIG" description:"The katago override-config, like: analysisPVLen=30,numSearchThreads=30"`
+	KataName           *string `long:"kata-name" env:"IKATAGO_KATA_NAME" description:"The katago binary name"`
+	KataWeight         *string `long:"kata-weight" env:"IKATAGO_KATA_WEIGHT" description:"The katago weight name"`
+	KataConfig         *string `long:"kata-config" env:"IKATAGO_KATA_CONFIG" description:"The katago config name"`
+	EngineType         *string `long:"engine-type" env:"IKATAGO_ENGINE_TYPE" description:"sets the enginetype"`
+	ForceNode          *string `long:"force-node" env:"IKATAGO_FORCE_NODE" description:"in cluster, force to a specific node."`
+	Token              *string `long:"token" env:"IKATAGO_TOKEN" description:"sets the token"`
+	GpuType            *string `long:"gpu-type" env:"IKATAGO_GPU_TYPE" description:"sets the gpu type"`
+	ExtraInfo          *string `long:"extra-info" env:"IKATAGO_EXTRA_INFO" description:"sets the extra info of the command"`
+	ClientID           *string `long:"client-id" env:"IKATAGO_CLIENT_ID" description:"sets the client id"`
+	Attach             *string `long:"attach" env:"IKATAGO_ATTACH" description:"attaches to the preloaded katago"`
+	Command            string  `long:"cmd" env:"IKATAGO_CMD" description:"The command to run the katago" default:"run-katago"`
 }
 
 // Client the client wrapper
@@ -67,12 +76,28 @@ type KatagoRunner struct {
 	extraInfo          *string
 	clientID           *string
 	subCommands        []string
-	reader             io.Reader
-	writer             io.Writer
-	stderrWriter       io.Writer
-	commandWriter      io.Writer
-	sessionResult      *client.SessionResult
-	started            bool
+	engineType         *string
+	gpuType            *string
+	forceNode          *string
+	recordFile         *string
+	fallbackKatago     *string
+	fallbackModel      *string
+	fallbackConfig     *string
+	attach             *string
+	lineCallback       LineCallback
+	framing            int
+	framingBufferSize  int
+	counters           runnerCounters
+
+	// lock guards the fields below, so that Run, Stop and SendGTPCommand can be called from any goroutine
+	lock          sync.Mutex
+	runCond       *sync.Cond
+	running       bool
+	stopping      bool
+	cancel        context.CancelFunc
+	commandWriter *io.PipeWriter
+	state         int
+	preloadID     string
 }
 
 type ClientRunner struct {
@@ -81,15 +106,18 @@ type ClientRunner struct {
 }
 
 func (notifier *dataNotifier) Write(p []byte) (n int, err error) {
-	if notifier.callback != nil {
+	if notifier.callback != nil && len(p) > 0 {
 		notifier.callback(p)
 	}
 	return len(p), nil
 }
 
 func NewClientRunnerFromArgs(argString string) (*ClientRunner, error) {
-	opts := model.AllOpts{}
-	subCommands, err := flags.ParseArgs(&opts, strings.Split(argString, " "))
+	opts, subCommands, err := config.ParseArgs(strings.Fields(argString))
+	if err != nil {
+		return nil, err
+	}
+	err = credentials.Resolve(opts, false)
 	if err != nil {
 		return nil, err
 	}
@@ -147,6 +175,16 @@ func NewClientRunnerFromArgs(argString string) (*ClientRunner, error) {
 	return &ClientRunner{Client: client, Runner: runner}, nil
 }
 
+// StartMetricsServer serves the prometheus metrics of all the clients at /metrics on the address in the background
+func StartMetricsServer(addr string) {
+	go func() {
+		err := metrics.ListenAndServe(addr)
+		if err != nil {
+			log.Printf("ERROR failed to serve the metrics: %v\n", err)
+		}
+	}()
+}
+
 // NewClient creates the new mobile client
 func NewClient(world string, platform string, username string, password string) (*Client, error) {
 	defaultWorld := utils.WorldURL
@@ -162,15 +200,27 @@ func NewClient(world string, platform string, username string, password string)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
+	c := &Client{
 		remoteClient: remoteClient,
-	}, nil
+	}
+	// applies the IKATAGO_* environment variables
+	c.SetExtraArgs("")
+	return c, nil
+}
+
+// parseGenericOptions parses the extra args. the IKATAGO_* environment variables are used for the options not in the args.
+func parseGenericOptions(extraArgs string) (*genericOptions, []string, error) {
+	opts := &genericOptions{}
+	subCommands, err := flags.ParseArgs(opts, strings.Fields(extraArgs))
+	if err != nil {
+		return nil, nil, err
+	}
+	return opts, subCommands, nil
 }
 
 // SetExtraArgs sets the extra args like "--gpu-type 3x --engine-type katago"
 func (client *Client) SetExtraArgs(extraArgs string) {
-	opts := genericOptions{}
-	_, err := flags.ParseArgs(&opts, strings.Split(extraArgs, " "))
+	opts, _, err := parseGenericOptions(extraArgs)
 	if err != nil {
 		return
 	}
@@ -210,6 +260,13 @@ func (client *Client) SetEngineType(engineType string) {
 	client.remoteClient.Options.EngineType = &engineType
 }
 
+// SetTraceFile traces the startup phases of the next katago run, and writes the trace into the file in the OTLP json format
+func (client *Client) SetTraceFile(traceFile string) {
+	tracer := tracing.NewTracer("ikatago-client", "run-katago")
+	tracer.ExportToFile(traceFile)
+	client.remoteClient.SetTracer(tracer)
+}
+
 // QueryServer queries the server info
 func (client *Client) QueryServer() (string, error) {
 	buf := bytes.NewBuffer(nil)
@@ -220,6 +277,19 @@ func (client *Client) QueryServer() (string, error) {
 	return buf.String(), nil
 }
 
+// QueryServerJSON queries the server info, and returns the parsed result as json
+func (client *Client) QueryServerJSON() (string, error) {
+	info, err := client.remoteClient.QueryServerInfo()
+	if err != nil {
+		return "", err
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
 // CreateKatagoRunner creates  the katago runner
 func (client *Client) CreateKatagoRunner() (*KatagoRunner, error) {
 	runner := &KatagoRunner{
@@ -229,93 +299,178 @@ func (client *Client) CreateKatagoRunner() (*KatagoRunner, error) {
 		noCompress:      false,
 		useRawData:      false,
 		subCommands:     make([]string, 0),
-		started:         false,
 	}
+	extraArgs := ""
 	if client.extraArgs != nil {
-		opts := genericOptions{}
-		subCommands, err := flags.ParseArgs(&opts, strings.Split(*client.extraArgs, " "))
-		if err == nil {
-			if len(subCommands) > 0 {
-				runner.SetSubCommands(strings.Join(subCommands, " "))
-			}
-			if opts.KataWeight != nil {
-				runner.SetKataWeight(*opts.KataWeight)
-			}
-			if opts.KataConfig != nil {
-				runner.SetKataConfig(*opts.KataConfig)
-			}
-			if opts.KataName != nil {
-				runner.SetKataName(*opts.KataName)
-			}
-			if opts.KataOverrideConfig != nil {
-				runner.SetKataOverrideConfig(*opts.KataOverrideConfig)
-			}
-			if opts.NoCompress != nil {
-				runner.DisableCompress(*opts.NoCompress)
-			}
-			if opts.RefreshInterval != nil {
-				runner.SetRefreshInterval(*opts.RefreshInterval)
-			}
-			if opts.TransmitMoveNum != nil {
-				runner.SetTransmitMoveNum(*opts.TransmitMoveNum)
-			}
-			if opts.KataLocalConfig != nil {
-				runner.SetKataLocalConfig(*opts.KataLocalConfig)
-			}
-			if opts.ExtraInfo != nil {
-				runner.SetExtraInfo(*opts.ExtraInfo)
-			}
-			if opts.ClientID != nil {
-				runner.SetClientID(*opts.ClientID)
-			}
+		extraArgs = *client.extraArgs
+	}
+	opts, subCommands, err := parseGenericOptions(extraArgs)
+	if err == nil {
+		if len(subCommands) > 0 {
+			runner.SetSubCommands(strings.Join(subCommands, " "))
+		}
+		if opts.KataWeight != nil {
+			runner.SetKataWeight(*opts.KataWeight)
+		}
+		if opts.KataConfig != nil {
+			runner.SetKataConfig(*opts.KataConfig)
+		}
+		if opts.KataName != nil {
+			runner.SetKataName(*opts.KataName)
+		}
+		if opts.KataOverrideConfig != nil {
+			runner.SetKataOverrideConfig(*opts.KataOverrideConfig)
+		}
+		if opts.NoCompress != nil {
+			runner.DisableCompress(*opts.NoCompress)
+		}
+		if opts.RefreshInterval != nil {
+			runner.SetRefreshInterval(*opts.RefreshInterval)
+		}
+		if opts.TransmitMoveNum != nil {
+			runner.SetTransmitMoveNum(*opts.TransmitMoveNum)
+		}
+		if opts.KataLocalConfig != nil {
+			runner.SetKataLocalConfig(*opts.KataLocalConfig)
+		}
+		if opts.ExtraInfo != nil {
+			runner.SetExtraInfo(*opts.ExtraInfo)
+		}
+		if opts.ClientID != nil {
+			runner.SetClientID(*opts.ClientID)
+		}
+		if opts.Attach != nil {
+			runner.SetAttach(*opts.Attach)
 		}
-
 	}
+
 	return runner, nil
 }
 
 // Run runs the katago
 func (katagoRunner *KatagoRunner) Run(callback DataCallback) error {
-	katagoRunner.started = true
-	options := client.RunKatagoOptions{
-		NoCompress:         katagoRunner.noCompress,
-		RefreshInterval:    katagoRunner.refreshInterval,
-		TransmitMoveNum:    katagoRunner.transmitMoveNum,
-		KataLocalConfig:    katagoRunner.kataLocalConfig,
-		KataOverrideConfig: katagoRunner.kataOverrideConfig,
-		KataName:           katagoRunner.kataName,
-		KataWeight:         katagoRunner.kataWeight,
-		KataConfig:         katagoRunner.kataConfig,
-		UseRawData:         katagoRunner.useRawData,
-		ExtraInfo:          katagoRunner.extraInfo,
-		ClientID:           katagoRunner.clientID,
-	}
-	katagoRunner.writer = &dataNotifier{
-		callback: callback.Callback,
+	return katagoRunner.RunWithListener(callback, nil)
+}
+
+// RunWithListener runs the katago, and notifies the listener with the lifecycle events. listener can be nil.
+// it blocks until the katago exits. if the previous run is being stopped, it waits for the previous run to finish first.
+// it returns the error of the session, like the connection is lost or katago exits with error, or nil if stopped by Stop.
+func (katagoRunner *KatagoRunner) RunWithListener(callback DataCallback, listener LifecycleListener) error {
+	return katagoRunner.run(false, callback, listener)
+}
+
+// RunPreload preloads katago on the server to load the model in advance, it blocks until Stop like RunWithListener.
+// PreloadID returns the id of the preload after OnReady, the runners of the same client attach to it
+// with SetAttach(id) or SetAttach("latest"). listener can be nil.
+func (katagoRunner *KatagoRunner) RunPreload(callback DataCallback, listener LifecycleListener) error {
+	return katagoRunner.run(true, callback, listener)
+}
+
+// PreloadID returns the id of the running preload started by RunPreload, it is empty if the preload is not ready
+func (katagoRunner *KatagoRunner) PreloadID() string {
+	katagoRunner.lock.Lock()
+	defer katagoRunner.lock.Unlock()
+	return katagoRunner.preloadID
+}
+
+func (katagoRunner *KatagoRunner) run(preload bool, callback DataCallback, listener LifecycleListener) error {
+	ctx, options, reader, err := katagoRunner.beginRun()
+	if err != nil {
+		return err
 	}
-	katagoRunner.stderrWriter = &dataNotifier{
-		callback: callback.StderrCallback,
+	defer katagoRunner.endRun(reader)
+
+	options.Context = ctx
+	options.OnEvent = katagoRunner.onEvent(listener)
+	katagoRunner.counters.onStart()
+	var writer io.Writer = &countingWriter{
+		writer:  &dataNotifier{callback: callback.Callback},
+		counter: &katagoRunner.counters.bytesReceived,
+	}
+	stderrWriter := &countingWriter{
+		writer:  &dataNotifier{callback: callback.StderrCallback},
+		counter: &katagoRunner.counters.stderrBytesReceived,
+	}
+	if katagoRunner.lineCallback != nil {
+		framer := newLineFramer(katagoRunner.lineCallback, katagoRunner.framing, katagoRunner.framingBufferSize)
+		defer framer.Close()
+		writer = io.MultiWriter(writer, framer)
+	}
+	var sessionResult *client.SessionResult
+	if preload {
+		preloadID := client.NewPreloadID()
+		options.PreloadID = &preloadID
+		sessionResult, err = katagoRunner.client.remoteClient.PreloadKatago(options, katagoRunner.subCommands, reader, writer, stderrWriter, func() {
+			katagoRunner.lock.Lock()
+			katagoRunner.preloadID = preloadID
+			katagoRunner.lock.Unlock()
+			callback.OnReady()
+		})
+	} else {
+		sessionResult, err = katagoRunner.client.remoteClient.RunKatago(options, katagoRunner.subCommands, reader, writer, stderrWriter, callback.OnReady)
 	}
-	pr, pw := io.Pipe()
-	katagoRunner.commandWriter = pw
-	katagoRunner.reader = pr
-	defer pw.Close()
-	defer pr.Close()
-
-	sessionResult, err := katagoRunner.client.remoteClient.RunKatago(options, katagoRunner.subCommands, katagoRunner.reader, katagoRunner.writer, katagoRunner.stderrWriter, callback.OnReady)
 	if err != nil {
-		katagoRunner.started = false
 		return err
 	}
-	katagoRunner.sessionResult = sessionResult
 	sessionResult.Wait()
-	katagoRunner.started = false
-	return nil
-}
-
-func (katagoRunner *KatagoRunner) RunWithStdio(command string) error {
-	remoteClient := katagoRunner.client.remoteClient
-	options := client.RunKatagoOptions{
+	katagoRunner.lock.Lock()
+	stopped := katagoRunner.stopping
+	katagoRunner.lock.Unlock()
+	if stopped {
+		// the session is closed by Stop, it is not an error
+		return nil
+	}
+	return sessionResult.Err
+}
+
+// SetLineCallback sets the callback which receives the complete lines or gtp responses, besides the DataCallback.
+// framing is FramingLine or FramingGTPResponse. at most bufferSize lines are queued for the callback,
+// the output of katago is paused when the queue is full. bufferSize <= 0 means the default size.
+func (katagoRunner *KatagoRunner) SetLineCallback(lineCallback LineCallback, framing int, bufferSize int) {
+	katagoRunner.lineCallback = lineCallback
+	katagoRunner.framing = framing
+	katagoRunner.framingBufferSize = bufferSize
+}
+
+// beginRun marks the runner as running, and prepares the options and the command pipe of this run
+func (katagoRunner *KatagoRunner) beginRun() (context.Context, client.RunKatagoOptions, *io.PipeReader, error) {
+	katagoRunner.lock.Lock()
+	defer katagoRunner.lock.Unlock()
+	if katagoRunner.runCond == nil {
+		katagoRunner.runCond = sync.NewCond(&katagoRunner.lock)
+	}
+	for katagoRunner.running {
+		if !katagoRunner.stopping {
+			return nil, client.RunKatagoOptions{}, nil, errors.New("already_running")
+		}
+		katagoRunner.runCond.Wait()
+	}
+	katagoRunner.running = true
+	katagoRunner.stopping = false
+	ctx, cancel := context.WithCancel(context.Background())
+	katagoRunner.cancel = cancel
+	reader, writer := io.Pipe()
+	katagoRunner.commandWriter = writer
+	return ctx, katagoRunner.buildOptions(), reader, nil
+}
+
+// endRun marks the runner as not running, and wakes up the pending runs
+func (katagoRunner *KatagoRunner) endRun(reader *io.PipeReader) {
+	katagoRunner.lock.Lock()
+	defer katagoRunner.lock.Unlock()
+	katagoRunner.cancel()
+	katagoRunner.commandWriter.Close()
+	reader.Close()
+	katagoRunner.running = false
+	katagoRunner.stopping = false
+	katagoRunner.cancel = nil
+	katagoRunner.commandWriter = nil
+	katagoRunner.preloadID = ""
+	katagoRunner.runCond.Broadcast()
+}
+
+func (katagoRunner *KatagoRunner) buildOptions() client.RunKatagoOptions {
+	return client.RunKatagoOptions{
 		NoCompress:         katagoRunner.noCompress,
 		RefreshInterval:    katagoRunner.refreshInterval,
 		TransmitMoveNum:    katagoRunner.transmitMoveNum,
@@ -327,34 +482,39 @@ func (katagoRunner *KatagoRunner) RunWithStdio(command string) error {
 		UseRawData:         katagoRunner.useRawData,
 		ExtraInfo:          katagoRunner.extraInfo,
 		ClientID:           katagoRunner.clientID,
+		EngineType:         katagoRunner.engineType,
+		GpuType:            katagoRunner.gpuType,
+		ForceNode:          katagoRunner.forceNode,
+		RecordFile:         katagoRunner.recordFile,
+		FallbackKatago:     katagoRunner.fallbackKatago,
+		FallbackModel:      katagoRunner.fallbackModel,
+		FallbackConfig:     katagoRunner.fallbackConfig,
+		Attach:             katagoRunner.attach,
 	}
-	if command == "run-katago" {
-		sessionResult, err := remoteClient.RunKatago(options, katagoRunner.subCommands, os.Stdin, os.Stdout, os.Stderr, nil)
-		if err != nil {
-			return err
-		}
-		sessionResult.Wait()
-	} else if command == "preload-katago" {
-		sessionResult, err := remoteClient.PreloadKatago(options, katagoRunner.subCommands, os.Stdin, os.Stdout, os.Stderr, nil)
-		if err != nil {
-			return err
-		}
-		sessionResult.Wait()
-	} else if command == "query-server" {
-		// run katago command
-		err := remoteClient.QueryServer(os.Stdout)
-		if err != nil {
-			return err
-		}
-	} else if command == "view-config" {
-		err := remoteClient.ViewConfig(options, katagoRunner.subCommands, os.Stdout)
-		if err != nil {
-			return err
-		}
-	} else {
-		return errors.New("unknown command")
+}
+
+// RunWithStdio runs the registered command, like run-katago, query-server, with the stdin and stdout of the process.
+// the flags of the commands are read from the extra args of the client.
+func (katagoRunner *KatagoRunner) RunWithStdio(command string) error {
+	extraArgs := ""
+	if katagoRunner.client.extraArgs != nil {
+		extraArgs = *katagoRunner.client.extraArgs
 	}
-	return nil
+	opts := &model.AllOpts{}
+	_, err := flags.NewParser(opts, flags.IgnoreUnknown).ParseArgs(strings.Fields(extraArgs))
+	if err != nil {
+		return err
+	}
+	opts.Command = command
+	return client.RunCommand(command, &client.CommandContext{
+		Client:      katagoRunner.client.remoteClient,
+		Options:     katagoRunner.buildOptions(),
+		SubCommands: katagoRunner.subCommands,
+		Flags:       opts,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	})
 }
 
 // SetKataWeight sets the name of the kata weight
@@ -377,6 +537,50 @@ func (katagoRunner *KatagoRunner) SetKataOverrideConfig(kataOverrideConfig strin
 	katagoRunner.kataOverrideConfig = &kataOverrideConfig
 }
 
+// SetOverrideConfigValue sets a key value pair of the override-config, like: maxVisits, 100
+func (katagoRunner *KatagoRunner) SetOverrideConfigValue(key string, value string) error {
+	overrideConfig := client.NewOverrideConfig()
+	if katagoRunner.kataOverrideConfig != nil {
+		parsed, err := client.ParseOverrideConfig(*katagoRunner.kataOverrideConfig)
+		if err != nil {
+			return err
+		}
+		overrideConfig = parsed
+	}
+	err := client.NewOverrideConfig().Set(key, value).Validate()
+	if err != nil {
+		return err
+	}
+	kataOverrideConfig := overrideConfig.Set(key, value).String()
+	katagoRunner.kataOverrideConfig = &kataOverrideConfig
+	return nil
+}
+
+// SetOverrideMaxVisits sets maxVisits of the override-config
+func (katagoRunner *KatagoRunner) SetOverrideMaxVisits(maxVisits int) error {
+	return katagoRunner.SetOverrideConfigValue("maxVisits", strconv.Itoa(maxVisits))
+}
+
+// SetOverrideNumSearchThreads sets numSearchThreads of the override-config
+func (katagoRunner *KatagoRunner) SetOverrideNumSearchThreads(numSearchThreads int) error {
+	return katagoRunner.SetOverrideConfigValue("numSearchThreads", strconv.Itoa(numSearchThreads))
+}
+
+// SetOverrideAnalysisPVLen sets analysisPVLen of the override-config
+func (katagoRunner *KatagoRunner) SetOverrideAnalysisPVLen(analysisPVLen int) error {
+	return katagoRunner.SetOverrideConfigValue("analysisPVLen", strconv.Itoa(analysisPVLen))
+}
+
+// SetOverridePlayoutDoublingAdvantage sets playoutDoublingAdvantage of the override-config
+func (katagoRunner *KatagoRunner) SetOverridePlayoutDoublingAdvantage(playoutDoublingAdvantage float64) error {
+	return katagoRunner.SetOverrideConfigValue("playoutDoublingAdvantage", strconv.FormatFloat(playoutDoublingAdvantage, 'f', -1, 64))
+}
+
+// SetOverrideRules sets rules of the override-config, like: chinese, japanese
+func (katagoRunner *KatagoRunner) SetOverrideRules(rules string) error {
+	return katagoRunner.SetOverrideConfigValue("rules", rules)
+}
+
 // SetKataName sets the name of the katago name
 func (katagoRunner *KatagoRunner) SetKataName(kataName string) {
 	katagoRunner.kataName = &kataName
@@ -397,6 +601,47 @@ func (katagoRunner *KatagoRunner) SetTransmitMoveNum(transmitMoveNum int) {
 	katagoRunner.transmitMoveNum = transmitMoveNum
 }
 
+// SetEngineType sets the engine type of this runner, overrides the one of the client
+func (katagoRunner *KatagoRunner) SetEngineType(engineType string) {
+	katagoRunner.engineType = &engineType
+}
+
+// SetGpuType sets the gpu type of this runner, overrides the one of the client
+func (katagoRunner *KatagoRunner) SetGpuType(gpuType string) {
+	katagoRunner.gpuType = &gpuType
+}
+
+// SetForceNode sets the node of this runner, overrides the one of the client
+func (katagoRunner *KatagoRunner) SetForceNode(forceNode string) {
+	katagoRunner.forceNode = &forceNode
+}
+
+// SetRecordFile records the gtp commands and the katago output of the next runs into the file
+func (katagoRunner *KatagoRunner) SetRecordFile(recordFile string) {
+	katagoRunner.recordFile = &recordFile
+}
+
+// SetFallbackKatago sets the local katago binary which takes over if the remote katago fails
+func (katagoRunner *KatagoRunner) SetFallbackKatago(fallbackKatago string) {
+	katagoRunner.fallbackKatago = &fallbackKatago
+}
+
+// SetFallbackModel sets the model file of the local katago
+func (katagoRunner *KatagoRunner) SetFallbackModel(fallbackModel string) {
+	katagoRunner.fallbackModel = &fallbackModel
+}
+
+// SetFallbackConfig sets the config file of the local katago
+func (katagoRunner *KatagoRunner) SetFallbackConfig(fallbackConfig string) {
+	katagoRunner.fallbackConfig = &fallbackConfig
+}
+
+// SetAttach attaches the next runs to the preloaded katago, attach is the PreloadID of RunPreload, the id printed
+// by preload-katago, or latest. latest is the running preload of the same client, or the latest in ~/.ikatago/preloads.json
+func (katagoRunner *KatagoRunner) SetAttach(attach string) {
+	katagoRunner.attach = &attach
+}
+
 // SetExtraInfo sets the extra info
 func (katagoRunner *KatagoRunner) SetExtraInfo(extraInfo string) {
 	katagoRunner.extraInfo = &extraInfo
@@ -413,10 +658,18 @@ func (katagoRunner *KatagoRunner) SendGTPCommand(command string) error {
 	if !strings.HasSuffix(command, "\n") {
 		command = command + "\n"
 	}
-	_, err := io.WriteString(katagoRunner.commandWriter, command)
+	katagoRunner.lock.Lock()
+	commandWriter := katagoRunner.commandWriter
+	katagoRunner.lock.Unlock()
+	if commandWriter == nil {
+		return errors.New("not_running")
+	}
+	// the writes to the pipe are serialized by the pipe itself
+	_, err := io.WriteString(commandWriter, command)
 	if err != nil {
 		return err
 	}
+	katagoRunner.counters.commandsSent.Add(1)
 	return nil
 }
 
@@ -430,21 +683,14 @@ func (katagoRunner *KatagoRunner) SetSubCommands(subCommands string) {
 	katagoRunner.subCommands = strings.Split(subCommands, " ")
 }
 
-// Stop stops the katago engine
+// Stop stops the katago engine. it does not wait for the engine to exit, so it is safe to be called from the callbacks.
+// Run can be called again right after Stop to restart the engine, it waits for the previous run to finish.
 func (katagoRunner *KatagoRunner) Stop() error {
-	c := 0
-	for katagoRunner.started && katagoRunner.sessionResult == nil {
-		time.Sleep(100 * time.Millisecond)
-		c++
-		if c >= 200 {
-			// 20 seconds
-			break
-		}
-	}
-	if katagoRunner.sessionResult != nil {
-		katagoRunner.sessionResult.Stop()
-		katagoRunner.sessionResult = nil
-		katagoRunner.started = false
+	katagoRunner.lock.Lock()
+	defer katagoRunner.lock.Unlock()
+	if katagoRunner.running && !katagoRunner.stopping {
+		katagoRunner.stopping = true
+		katagoRunner.cancel()
 	}
 	return nil
 }
@@ -0,0 +1,71 @@
+package ikatagosdk
+
+import (
+	"github.com/kinfkong/ikatago-client/client"
+)
+
+// the states of the katago runner
+const (
+	StateIdle = iota
+	StateConnecting
+	StateConnected
+	StateUploadingConfig
+	StateConfigUploaded
+	StateEngineStarted
+	StateExited
+	StateDisconnected
+	StateFailed
+)
+
+// LifecycleListener receives the lifecycle events of the katago runner
+type LifecycleListener interface {
+	// OnStateChanged is called when the state changes, see the State* constants
+	OnStateChanged(state int, message string)
+	// OnError is called when an error happens, errorClass is like auth, connection, discovery, config, remote
+	OnError(errorClass string, message string)
+	// OnExit is called when the remote engine exits, exitCode is -1 if the engine did not exit normally
+	OnExit(exitCode int)
+}
+
+var eventStates = map[string]int{
+	client.EventConnecting:      StateConnecting,
+	client.EventConnected:       StateConnected,
+	client.EventUploadingConfig: StateUploadingConfig,
+	client.EventConfigUploaded:  StateConfigUploaded,
+	client.EventEngineStarted:   StateEngineStarted,
+	client.EventExited:          StateExited,
+	client.EventDisconnected:    StateDisconnected,
+	client.EventFailed:          StateFailed,
+}
+
+// onEvent converts the client event to the listener callbacks
+func (katagoRunner *KatagoRunner) onEvent(listener LifecycleListener) func(event client.Event) {
+	return func(event client.Event) {
+		state := eventStates[event.Type]
+		katagoRunner.lock.Lock()
+		katagoRunner.state = state
+		katagoRunner.lock.Unlock()
+		message := event.Type
+		if event.Err != nil {
+			message = event.Err.Error()
+			katagoRunner.counters.lastError.Store(message)
+		}
+		if listener == nil {
+			return
+		}
+		listener.OnStateChanged(state, message)
+		if event.Err != nil && event.Type != client.EventExited {
+			listener.OnError(event.ErrorClass, event.Err.Error())
+		}
+		if event.Type == client.EventExited {
+			listener.OnExit(event.ExitCode)
+		}
+	}
+}
+
+// State returns the current state of the runner, see the State* constants
+func (katagoRunner *KatagoRunner) State() int {
+	katagoRunner.lock.Lock()
+	defer katagoRunner.lock.Unlock()
+	return katagoRunner.state
+}
@@ -0,0 +1,73 @@
+package ikatagosdk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGenericOptions(t *testing.T) {
+	tests := []struct {
+		name            string
+		extraArgs       string
+		env             map[string]string
+		gpuType         string
+		refreshInterval int
+		command         string
+		subCommands     []string
+	}{
+		{
+			name:    "default",
+			command: "run-katago",
+		},
+		{
+			name:            "env",
+			env:             map[string]string{"IKATAGO_GPU_TYPE": "2x", "IKATAGO_REFRESH_INTERVAL": "50", "IKATAGO_CMD": "query-server"},
+			gpuType:         "2x",
+			refreshInterval: 50,
+			command:         "query-server",
+		},
+		{
+			name:            "flag over env",
+			extraArgs:       "--gpu-type 4x --refresh-interval 70 -- analysis -analysis-threads 12",
+			env:             map[string]string{"IKATAGO_GPU_TYPE": "2x", "IKATAGO_REFRESH_INTERVAL": "50"},
+			gpuType:         "4x",
+			refreshInterval: 70,
+			command:         "run-katago",
+			subCommands:     []string{"analysis", "-analysis-threads", "12"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			opts, subCommands, err := parseGenericOptions(test.extraArgs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gpuType := ""
+			if opts.GpuType != nil {
+				gpuType = *opts.GpuType
+			}
+			if gpuType != test.gpuType {
+				t.Errorf("gpu type: got %q, want %q", gpuType, test.gpuType)
+			}
+			refreshInterval := 0
+			if opts.RefreshInterval != nil {
+				refreshInterval = *opts.RefreshInterval
+			}
+			if refreshInterval != test.refreshInterval {
+				t.Errorf("refresh interval: got %d, want %d", refreshInterval, test.refreshInterval)
+			}
+			if opts.Command != test.command {
+				t.Errorf("command: got %q, want %q", opts.Command, test.command)
+			}
+			if len(subCommands) == 0 {
+				subCommands = nil
+			}
+			if !reflect.DeepEqual(subCommands, test.subCommands) {
+				t.Errorf("subcommands: got %v, want %v", subCommands, test.subCommands)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package ikatagosdk
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RunnerStats represents the statistics of a katago runner
+type RunnerStats struct {
+	Name                string `json:"name,omitempty"`
+	State               int    `json:"state"`
+	Running             bool   `json:"running"`
+	Runs                int64  `json:"runs"`
+	CommandsSent        int64  `json:"commandsSent"`
+	BytesReceived       int64  `json:"bytesReceived"`
+	StderrBytesReceived int64  `json:"stderrBytesReceived"`
+	LastStartedAt       int64  `json:"lastStartedAt"`
+	LastError           string `json:"lastError,omitempty"`
+}
+
+// runnerCounters counts the traffic of a katago runner
+type runnerCounters struct {
+	runs                atomic.Int64
+	commandsSent        atomic.Int64
+	bytesReceived       atomic.Int64
+	stderrBytesReceived atomic.Int64
+	lastStartedAt       atomic.Int64
+	lastError           atomic.Value
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	counter *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.counter.Add(int64(len(p)))
+	return w.writer.Write(p)
+}
+
+// Stats returns the statistics of the runner as json
+func (katagoRunner *KatagoRunner) Stats() string {
+	content, _ := json.Marshal(katagoRunner.stats())
+	return string(content)
+}
+
+func (katagoRunner *KatagoRunner) stats() RunnerStats {
+	katagoRunner.lock.Lock()
+	stats := RunnerStats{
+		State:   katagoRunner.state,
+		Running: katagoRunner.running,
+	}
+	katagoRunner.lock.Unlock()
+	counters := &katagoRunner.counters
+	stats.Runs = counters.runs.Load()
+	stats.CommandsSent = counters.commandsSent.Load()
+	stats.BytesReceived = counters.bytesReceived.Load()
+	stats.StderrBytesReceived = counters.stderrBytesReceived.Load()
+	stats.LastStartedAt = counters.lastStartedAt.Load()
+	if lastError, ok := counters.lastError.Load().(string); ok {
+		stats.LastError = lastError
+	}
+	return stats
+}
+
+// EnginePool runs several katago runners of the same client at the same time, like a strong reviewer and a fast hinting engine.
+// the runners share the discovery and the ssh connection of the client.
+type EnginePool struct {
+	client  *Client
+	lock    sync.Mutex
+	runners map[string]*KatagoRunner
+}
+
+// CreateEnginePool creates the engine pool, the sessions of the client share one ssh connection from now on
+func (client *Client) CreateEnginePool() *EnginePool {
+	client.remoteClient.ShareConnection()
+	return &EnginePool{
+		client:  client,
+		runners: make(map[string]*KatagoRunner),
+	}
+}
+
+// CreateEngine creates a runner of the pool with the name, the runner can be configured with its setters before starting
+func (pool *EnginePool) CreateEngine(name string) (*KatagoRunner, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if _, ok := pool.runners[name]; ok {
+		return nil, errors.New("engine_exists")
+	}
+	runner, err := pool.client.CreateKatagoRunner()
+	if err != nil {
+		return nil, err
+	}
+	pool.runners[name] = runner
+	return runner, nil
+}
+
+// GetEngine gets the runner by name
+func (pool *EnginePool) GetEngine(name string) (*KatagoRunner, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	runner, ok := pool.runners[name]
+	if !ok {
+		return nil, errors.New("engine_not_found")
+	}
+	return runner, nil
+}
+
+// Start starts the engine in the background, the listener can be nil
+func (pool *EnginePool) Start(name string, callback DataCallback, listener LifecycleListener) error {
+	runner, err := pool.GetEngine(name)
+	if err != nil {
+		return err
+	}
+	go runner.RunWithListener(callback, listener)
+	return nil
+}
+
+// SendGTPCommand sends the gtp command to the engine
+func (pool *EnginePool) SendGTPCommand(name string, command string) error {
+	runner, err := pool.GetEngine(name)
+	if err != nil {
+		return err
+	}
+	return runner.SendGTPCommand(command)
+}
+
+// Stop stops the engine
+func (pool *EnginePool) Stop(name string) error {
+	runner, err := pool.GetEngine(name)
+	if err != nil {
+		return err
+	}
+	return runner.Stop()
+}
+
+// Remove stops the engine and removes it from the pool
+func (pool *EnginePool) Remove(name string) error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	runner, ok := pool.runners[name]
+	if !ok {
+		return errors.New("engine_not_found")
+	}
+	delete(pool.runners, name)
+	return runner.Stop()
+}
+
+// StopAll stops all the engines
+func (pool *EnginePool) StopAll() {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	for _, runner := range pool.runners {
+		runner.Stop()
+	}
+}
+
+// Stats returns the statistics of the engine as json
+func (pool *EnginePool) Stats(name string) (string, error) {
+	runner, err := pool.GetEngine(name)
+	if err != nil {
+		return "", err
+	}
+	stats := runner.stats()
+	stats.Name = name
+	content, err := json.Marshal(stats)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// AllStats returns the statistics of all the engines as a json array, ordered by name
+func (pool *EnginePool) AllStats() string {
+	pool.lock.Lock()
+	names := make([]string, 0, len(pool.runners))
+	for name := range pool.runners {
+		names = append(names, name)
+	}
+	pool.lock.Unlock()
+	sort.Strings(names)
+	allStats := make([]RunnerStats, 0, len(names))
+	for _, name := range names {
+		runner, err := pool.GetEngine(name)
+		if err != nil {
+			continue
+		}
+		stats := runner.stats()
+		stats.Name = name
+		allStats = append(allStats, stats)
+	}
+	content, _ := json.Marshal(allStats)
+	return string(content)
+}
+
+func (counters *runnerCounters) onStart() {
+	counters.runs.Add(1)
+	counters.lastStartedAt.Store(time.Now().Unix())
+}
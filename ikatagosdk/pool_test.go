@@ -0,0 +1,57 @@
+package ikatagosdk
+
+import (
+	"testing"
+)
+
+// startPoolEngine starts the engine of the pool and waits until it is ready
+func startPoolEngine(t *testing.T, pool *EnginePool, name string) *testCallback {
+	runner, err := pool.CreateEngine(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.DisableCompress(true)
+	runner.SetUseRawData(true)
+	callback := newTestCallback()
+	if err := pool.Start(name, callback, nil); err != nil {
+		t.Fatal(err)
+	}
+	callback.waitReady(t)
+	return callback
+}
+
+func TestEnginePoolSharedConnection(t *testing.T) {
+	server := newFakeServer(t)
+	pool := server.newClient(t).CreateEnginePool()
+	defer pool.StopAll()
+	reviewer := startPoolEngine(t, pool, "reviewer")
+	hinter := startPoolEngine(t, pool, "hinter")
+
+	// a session refused by the server does not close the connection the running engines are using
+	server.RejectSessions(1)
+	failed, err := pool.CreateEngine("failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed.DisableCompress(true)
+	if err := failed.Run(newTestCallback()); err == nil {
+		t.Error("the engine refused by the server: got nil error")
+	}
+	if err := pool.SendGTPCommand("reviewer", "version"); err != nil {
+		t.Fatal(err)
+	}
+	reviewer.waitOutput(t, "= 1.12.0")
+
+	// the other engine keeps answering after one stops
+	if err := pool.Stop("reviewer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.SendGTPCommand("hinter", "name"); err != nil {
+		t.Fatal(err)
+	}
+	hinter.waitOutput(t, "= KataGo")
+	if err := pool.SendGTPCommand("hinter", "version"); err != nil {
+		t.Fatal(err)
+	}
+	hinter.waitOutput(t, "= 1.12.0")
+}
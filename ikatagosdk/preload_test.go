@@ -0,0 +1,92 @@
+package ikatagosdk
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kinfkong/ikatago-client/client"
+)
+
+func TestRunnerPreloadAndAttach(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	server := newFakeServer(t)
+	c := server.newClient(t)
+	preloadRunner, err := c.CreateKatagoRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	preloadRunner.DisableCompress(true)
+	preloadRunner.SetUseRawData(true)
+	preloadCallback := newTestCallback()
+	preloadResult := make(chan error, 1)
+	go func() {
+		preloadResult <- preloadRunner.RunPreload(preloadCallback, nil)
+	}()
+	preloadCallback.waitReady(t)
+	preloadID := preloadRunner.PreloadID()
+	if len(preloadID) == 0 {
+		t.Fatal("no preload id after ready")
+	}
+
+	runner, err := c.CreateKatagoRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.DisableCompress(true)
+	runner.SetUseRawData(true)
+	runner.SetAttach(client.AttachLatest)
+	callback := newTestCallback()
+	result := runAsync(runner, callback)
+	callback.waitReady(t)
+	runner.Stop()
+	waitRun(t, result)
+	if !containsCommand(server.Commands(), "run-katago --attach "+preloadID) {
+		t.Errorf("run-katago is not attached to %s: %q", preloadID, server.Commands())
+	}
+
+	preloadRunner.Stop()
+	waitRun(t, preloadResult)
+	if id := preloadRunner.PreloadID(); len(id) != 0 {
+		t.Errorf("preload id after stop: got %q", id)
+	}
+	store, err := client.DefaultPreloadStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	preloads, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preloads) != 0 {
+		t.Errorf("the preload is not removed from the store after stop: %+v", preloads)
+	}
+	runner.SetAttach(client.AttachLatest)
+	if err := runner.Run(newTestCallback()); err == nil || err.Error() != "preload_not_found" {
+		t.Errorf("attach after the preload stopped: got %v, want preload_not_found", err)
+	}
+}
+
+func TestRunnerAttachNotSupported(t *testing.T) {
+	server := newFakeServer(t)
+	server.legacy = true
+	runner := newTestRunner(t, server)
+	runner.SetAttach("0123456789abcdef")
+	err := runner.Run(newTestCallback())
+	if err == nil || err.Error() != "preload_not_supported" {
+		t.Fatalf("got %v, want preload_not_supported", err)
+	}
+	if exitCode := client.CommandExitCode(err); exitCode != client.ExitCodeConfig {
+		t.Errorf("exit code: got %d, want %d", exitCode, client.ExitCodeConfig)
+	}
+}
+
+func containsCommand(commands []string, prefix string) bool {
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
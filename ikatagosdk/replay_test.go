@@ -0,0 +1,74 @@
+package ikatagosdk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kinfkong/ikatago-client/client"
+)
+
+// recordSession runs the commands on the fake server with the record file, and returns the entries of the record
+func recordSession(t *testing.T, server *fakeServer, commands ...string) []client.RecordEntry {
+	recordFile := filepath.Join(t.TempDir(), "session.jsonl")
+	runner := newTestRunner(t, server)
+	runner.SetRecordFile(recordFile)
+	callback := newTestCallback()
+	result := runAsync(runner, callback)
+	callback.waitReady(t)
+	for _, command := range commands {
+		if err := runner.SendGTPCommand(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := waitRun(t, result); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := client.ReadRecord(recordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func replay(t *testing.T, server *fakeServer, entries []client.RecordEntry) []client.ReplayDiff {
+	diffs, err := server.newClient(t).remoteClient.Replay(client.RunKatagoOptions{NoCompress: true}, nil, entries, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return diffs
+}
+
+func TestReplay(t *testing.T) {
+	server := newFakeServer(t)
+	entries := recordSession(t, server, "version", "1 name", "foo", "quit")
+	if diffs := replay(t, server, entries); len(diffs) != 0 {
+		t.Errorf("replaying the record: got %+v, want no differences", diffs)
+	}
+	replayed := 0
+	for _, cmd := range server.Commands() {
+		if strings.HasPrefix(cmd, "run-katago") {
+			replayed++
+		}
+	}
+	if replayed != 2 {
+		t.Errorf("got %d run-katago commands, want the record and the replay", replayed)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	server := newFakeServer(t)
+	entries := recordSession(t, server, "version", "name", "quit")
+	// like the record of an older katago
+	for i := range entries {
+		if entries[i].Stream == client.RecordStdout {
+			entries[i].Data = strings.Replace(entries[i].Data, "1.12.0", "1.11.0", 1)
+		}
+	}
+	diffs := replay(t, server, entries)
+	want := client.ReplayDiff{Index: 1, Command: "version", Expected: "= 1.11.0", Actual: "= 1.12.0"}
+	if len(diffs) != 1 || diffs[0] != want {
+		t.Errorf("got %+v, want %+v", diffs, want)
+	}
+}
@@ -0,0 +1,286 @@
+package ikatagosdk
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/client"
+	"github.com/kinfkong/ikatago-client/katassh"
+	"github.com/kinfkong/ikatago-client/model"
+)
+
+// testCallback collects the output of the runner
+type testCallback struct {
+	lock   sync.Mutex
+	output strings.Builder
+	ready  chan struct{}
+	once   sync.Once
+}
+
+func newTestCallback() *testCallback {
+	return &testCallback{ready: make(chan struct{})}
+}
+
+func (callback *testCallback) Callback(content []byte) {
+	callback.lock.Lock()
+	defer callback.lock.Unlock()
+	callback.output.Write(content)
+}
+
+func (callback *testCallback) StderrCallback(content []byte) {
+}
+
+func (callback *testCallback) OnReady() {
+	callback.once.Do(func() {
+		close(callback.ready)
+	})
+}
+
+func (callback *testCallback) Output() string {
+	callback.lock.Lock()
+	defer callback.lock.Unlock()
+	return callback.output.String()
+}
+
+// waitOutput waits until the output contains s
+func (callback *testCallback) waitOutput(t *testing.T, s string) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(callback.Output(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %q, output: %q", s, callback.Output())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (callback *testCallback) waitReady(t *testing.T) {
+	select {
+	case <-callback.ready:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for katago to be ready")
+	}
+}
+
+func newTestRunner(t *testing.T, server *fakeServer) *KatagoRunner {
+	runner, err := server.newClient(t).CreateKatagoRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.DisableCompress(true)
+	runner.SetUseRawData(true)
+	return runner
+}
+
+// runAsync runs the runner in a goroutine, the error of Run is sent to the returned channel
+func runAsync(runner *KatagoRunner, callback DataCallback) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- runner.Run(callback)
+	}()
+	return result
+}
+
+// waitRunning waits until Run has begun, Stop before that does not stop the later run
+func waitRunning(t *testing.T, runner *KatagoRunner) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		runner.lock.Lock()
+		running := runner.running
+		runner.lock.Unlock()
+		if running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for Run to begin")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitRun(t *testing.T, result <-chan error) error {
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for Run to return")
+	}
+	return nil
+}
+
+func TestRunnerSendGTPCommand(t *testing.T) {
+	server := newFakeServer(t)
+	runner := newTestRunner(t, server)
+	if err := runner.SendGTPCommand("version"); err == nil || err.Error() != "not_running" {
+		t.Errorf("SendGTPCommand before Run: got %v, want not_running", err)
+	}
+	callback := newTestCallback()
+	result := runAsync(runner, callback)
+	callback.waitReady(t)
+
+	// the commands are sent from many goroutines at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runner.SendGTPCommand("name"); err != nil {
+				t.Errorf("SendGTPCommand: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := runner.SendGTPCommand("version"); err != nil {
+		t.Fatal(err)
+	}
+	callback.waitOutput(t, "= 1.12.0")
+	if count := strings.Count(callback.Output(), "= KataGo"); count != 10 {
+		t.Errorf("got %d responses of name, want 10", count)
+	}
+
+	if err := runner.SendGTPCommand("quit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitRun(t, result); err != nil {
+		t.Errorf("Run after quit: got %v, want nil", err)
+	}
+	if err := runner.SendGTPCommand("version"); err == nil {
+		t.Error("SendGTPCommand after the run finished: got nil error")
+	}
+}
+
+func TestRunnerStop(t *testing.T) {
+	server := newFakeServer(t)
+	runner := newTestRunner(t, server)
+	if err := runner.Stop(); err != nil {
+		t.Errorf("Stop before Run: %v", err)
+	}
+	callback := newTestCallback()
+	result := runAsync(runner, callback)
+	callback.waitReady(t)
+
+	// Stop can be called from any goroutine and more than once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runner.Stop()
+			runner.SendGTPCommand("version")
+		}()
+	}
+	wg.Wait()
+	if err := waitRun(t, result); err != nil {
+		t.Errorf("Run stopped by Stop: got %v, want nil", err)
+	}
+	if state := runner.State(); state == StateEngineStarted {
+		t.Errorf("state after Stop: got %d", state)
+	}
+}
+
+func TestRunnerStopWhileConnecting(t *testing.T) {
+	server := newFakeServer(t)
+	runner := newTestRunner(t, server)
+	// stops at different moments of the startup, Run must always return
+	for i := 0; i < 5; i++ {
+		result := runAsync(runner, newTestCallback())
+		waitRunning(t, runner)
+		time.Sleep(time.Duration(i) * 5 * time.Millisecond)
+		runner.Stop()
+		waitRun(t, result)
+	}
+}
+
+func TestRunnerRestart(t *testing.T) {
+	server := newFakeServer(t)
+	runner := newTestRunner(t, server)
+	first := newTestCallback()
+	firstResult := runAsync(runner, first)
+	first.waitReady(t)
+	if err := runner.SendGTPCommand("version"); err != nil {
+		t.Fatal(err)
+	}
+	first.waitOutput(t, "= 1.12.0")
+
+	// Run right after Stop waits for the previous run to finish
+	runner.Stop()
+	second := newTestCallback()
+	secondResult := runAsync(runner, second)
+	waitRun(t, firstResult)
+	second.waitReady(t)
+	if err := runner.SendGTPCommand("name"); err != nil {
+		t.Fatal(err)
+	}
+	second.waitOutput(t, "= KataGo")
+	if strings.Contains(first.Output(), "KataGo") {
+		t.Errorf("the output of the second run is sent to the first callback: %q", first.Output())
+	}
+
+	// Run while running is refused
+	if err := runner.Run(newTestCallback()); err == nil || err.Error() != "already_running" {
+		t.Errorf("Run while running: got %v, want already_running", err)
+	}
+	runner.Stop()
+	waitRun(t, secondResult)
+
+	runs := 0
+	for _, cmd := range server.Commands() {
+		if strings.HasPrefix(cmd, "run-katago") {
+			runs++
+		}
+	}
+	if runs != 2 {
+		t.Errorf("got %d run-katago commands on the server, want 2", runs)
+	}
+}
+
+func TestSessionStoppedBeforeStart(t *testing.T) {
+	server := newFakeServer(t)
+	addr := server.listener.Addr().(*net.TCPAddr)
+	session := &katassh.KataSSHSession{}
+	session.Stop()
+	err := session.RunKatago(model.SSHOptions{Host: addr.IP.String(), Port: addr.Port, User: fakeUser, Password: fakePassword}, "run-katago", strings.NewReader(""), ioutil.Discard, ioutil.Discard, true, nil)
+	if !errors.Is(err, katassh.ErrStopped) {
+		t.Errorf("got %v, want %v", err, katassh.ErrStopped)
+	}
+}
+
+func TestRunnerLastErrorWithoutListener(t *testing.T) {
+	server := newFakeServer(t)
+	c, err := NewClient(server.world.URL+"/world.json", fakePlatform, fakeUser, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner, err := c.CreateKatagoRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Run(newTestCallback()); err == nil {
+		t.Fatal("Run with the wrong password: got nil error")
+	}
+	if stats := runner.stats(); len(stats.LastError) == 0 {
+		t.Errorf("the last error is not recorded: %+v", stats)
+	}
+}
+
+func TestRunnerRemoteExitStatus(t *testing.T) {
+	server := newFakeServer(t)
+	runner := newTestRunner(t, server)
+	callback := newTestCallback()
+	result := runAsync(runner, callback)
+	callback.waitReady(t)
+	if err := runner.SendGTPCommand("die"); err != nil {
+		t.Fatal(err)
+	}
+	err := waitRun(t, result)
+	if status := client.ExitCodeOf(err); status != 3 {
+		t.Errorf("exit status: got %d (%v), want 3", status, err)
+	}
+	if exitCode := client.CommandExitCode(err); exitCode != client.ExitCodeRemote {
+		t.Errorf("exit code: got %d, want %d", exitCode, client.ExitCodeRemote)
+	}
+}
@@ -0,0 +1,72 @@
+package ikatagosdk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var customConfigPattern = regexp.MustCompile(`--custom-config (\S+)`)
+
+// runWithConfig runs katago with the local config until it is ready, and returns the --custom-config of the command
+func runWithConfig(t *testing.T, server *fakeServer, config string) string {
+	runner := newTestRunner(t, server)
+	runner.SetKataLocalConfig(config)
+	callback := newTestCallback()
+	result := runAsync(runner, callback)
+	callback.waitReady(t)
+	runner.Stop()
+	if err := waitRun(t, result); err != nil {
+		t.Fatal(err)
+	}
+	commands := server.Commands()
+	match := customConfigPattern.FindStringSubmatch(commands[len(commands)-1])
+	if match == nil {
+		t.Fatalf("no --custom-config in %q", commands[len(commands)-1])
+	}
+	return match[1]
+}
+
+func countUploads(server *fakeServer) int {
+	uploads := 0
+	for _, cmd := range server.Commands() {
+		if strings.HasPrefix(cmd, "scp-config") {
+			uploads++
+		}
+	}
+	return uploads
+}
+
+func TestRunnerUploadConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := newFakeServer(t)
+	config := filepath.Join(t.TempDir(), "gtp.cfg")
+	if err := ioutil.WriteFile(config, []byte("numSearchThreads = 8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	name := runWithConfig(t, server, config)
+	if content, ok := server.Config(name); !ok || content != "numSearchThreads = 8\n" {
+		t.Errorf("the config %s is not uploaded: %q", name, content)
+	}
+	// the upload is recorded under the home, so that it is skipped by the clients of the later processes
+	if again := runWithConfig(t, server, config); again != name {
+		t.Errorf("got --custom-config %s, want %s", again, name)
+	}
+	if uploads := countUploads(server); uploads != 1 {
+		t.Errorf("got %d uploads of the same content, want 1", uploads)
+	}
+
+	if err := ioutil.WriteFile(config, []byte("numSearchThreads = 16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := runWithConfig(t, server, config)
+	if changed == name {
+		t.Errorf("the changed config has the same name %s", name)
+	}
+	if content, _ := server.Config(changed); content != "numSearchThreads = 16\n" {
+		t.Errorf("the changed config %s is not uploaded: %q", changed, content)
+	}
+}
@@ -0,0 +1,315 @@
+// Package kataconfig parses and checks the katago .cfg files locally, before they are uploaded to the server.
+package kataconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SeverityError means katago refuses or misbehaves with the config
+	SeverityError = "error"
+	// SeverityWarning means the config is probably not what the user wants
+	SeverityWarning = "warning"
+
+	// OverrideSource is the source name of the issues found in the override config
+	OverrideSource = "override-config"
+)
+
+// Entry represents a key value pair in the config
+type Entry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Line   int    `json:"line"`
+	Source string `json:"source"`
+}
+
+// Issue represents a problem found in the config
+type Issue struct {
+	Source   string `json:"source"`
+	Line     int    `json:"line"`
+	Key      string `json:"key,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Config represents the parsed katago config
+type Config struct {
+	entries map[string]Entry
+	keys    []string
+}
+
+func (issue Issue) String() string {
+	location := issue.Source
+	if issue.Line > 0 {
+		location = fmt.Sprintf("%s:%d", issue.Source, issue.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, issue.Severity, issue.Message)
+}
+
+// HasErrors checks if any of the issues is an error
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFile parses the config file
+func ParseFile(path string) (*Config, []Issue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return Parse(f, path)
+}
+
+// Parse parses the config from the reader, source is used in the issues to locate the file
+func Parse(reader io.Reader, source string) (*Config, []Issue, error) {
+	config := &Config{
+		entries: make(map[string]Entry),
+		keys:    make([]string, 0),
+	}
+	issues := make([]Issue, 0)
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			issues = append(issues, Issue{Source: source, Line: lineNumber, Severity: SeverityError, Message: fmt.Sprintf("expected key = value, got: %s", line)})
+			continue
+		}
+		entry := Entry{
+			Key:    strings.TrimSpace(line[:idx]),
+			Value:  strings.TrimSpace(line[idx+1:]),
+			Line:   lineNumber,
+			Source: source,
+		}
+		if previous, ok := config.entries[entry.Key]; ok {
+			issues = append(issues, Issue{Source: source, Line: lineNumber, Key: entry.Key, Severity: SeverityError, Message: fmt.Sprintf("duplicated key %s, first defined at line %d", entry.Key, previous.Line)})
+			continue
+		}
+		issues = append(issues, checkEntry(entry)...)
+		config.set(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return config, issues, nil
+}
+
+// SplitOverride splits the override config into the key=value pairs. the commas inside the quotes, braces and brackets
+// are part of the value, like: rules={"ko":"SIMPLE","scoring":"AREA"},maxVisits=100
+func SplitOverride(overrideConfig string) []string {
+	pairs := make([]string, 0)
+	depth := 0
+	var quote rune
+	start := 0
+	for i, c := range overrideConfig {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{' || c == '[':
+			depth++
+		case (c == '}' || c == ']') && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			pairs = append(pairs, overrideConfig[start:i])
+			start = i + 1
+		}
+	}
+	return append(pairs, overrideConfig[start:])
+}
+
+// ParseOverride parses the override config, like: analysisPVLen=30,numSearchThreads=30
+func ParseOverride(overrideConfig string) ([]Entry, []Issue) {
+	entries := make([]Entry, 0)
+	issues := make([]Issue, 0)
+	seen := make(map[string]bool)
+	for _, pair := range SplitOverride(overrideConfig) {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		idx := strings.Index(pair, "=")
+		if idx < 0 {
+			issues = append(issues, Issue{Source: OverrideSource, Severity: SeverityError, Message: fmt.Sprintf("expected key=value, got: %s", pair)})
+			continue
+		}
+		entry := Entry{
+			Key:    strings.TrimSpace(pair[:idx]),
+			Value:  strings.TrimSpace(pair[idx+1:]),
+			Source: OverrideSource,
+		}
+		if seen[entry.Key] {
+			issues = append(issues, Issue{Source: OverrideSource, Key: entry.Key, Severity: SeverityError, Message: fmt.Sprintf("duplicated key %s", entry.Key)})
+			continue
+		}
+		seen[entry.Key] = true
+		issues = append(issues, checkEntry(entry)...)
+		entries = append(entries, entry)
+	}
+	return entries, issues
+}
+
+// Check parses the config file, merges the override config on top of it, and reports all the issues
+func Check(path string, overrideConfig *string) (*Config, []Issue, error) {
+	config, issues, err := ParseFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if overrideConfig != nil && len(*overrideConfig) > 0 {
+		entries, overrideIssues := ParseOverride(*overrideConfig)
+		issues = append(issues, overrideIssues...)
+		config.Merge(entries)
+	}
+	return config, issues, nil
+}
+
+// CheckValue checks if the value is valid for the key
+func CheckValue(key string, value string) []Issue {
+	return checkEntry(Entry{Key: key, Value: value, Source: OverrideSource})
+}
+
+// Merge overrides the config with the entries
+func (config *Config) Merge(entries []Entry) {
+	for _, entry := range entries {
+		config.set(entry)
+	}
+}
+
+// Get gets the value of the key
+func (config *Config) Get(key string) (string, bool) {
+	entry, ok := config.entries[key]
+	return entry.Value, ok
+}
+
+// Entries returns all the entries in the order they first appear
+func (config *Config) Entries() []Entry {
+	entries := make([]Entry, 0, len(config.keys))
+	for _, key := range config.keys {
+		entries = append(entries, config.entries[key])
+	}
+	return entries
+}
+
+func (config *Config) set(entry Entry) {
+	if _, ok := config.entries[entry.Key]; !ok {
+		config.keys = append(config.keys, entry.Key)
+	}
+	config.entries[entry.Key] = entry
+}
+
+func checkEntry(entry Entry) []Issue {
+	newIssue := func(severity string, format string, args ...interface{}) []Issue {
+		return []Issue{{Source: entry.Source, Line: entry.Line, Key: entry.Key, Severity: severity, Message: fmt.Sprintf(format, args...)}}
+	}
+	if len(entry.Key) == 0 {
+		return newIssue(SeverityError, "empty key")
+	}
+	spec, ok := lookupKey(entry.Key)
+	if !ok {
+		return newIssue(SeverityWarning, "unknown key %s", entry.Key)
+	}
+	if len(entry.Value) == 0 {
+		return newIssue(SeverityError, "empty value of %s", entry.Key)
+	}
+	switch spec.Type {
+	case typeBool:
+		if _, err := parseBool(entry.Value); err != nil {
+			return newIssue(SeverityError, "%s must be true or false, got: %s", entry.Key, entry.Value)
+		}
+	case typeInt:
+		value, err := strconv.ParseInt(entry.Value, 10, 64)
+		if err != nil {
+			return newIssue(SeverityError, "%s must be an integer, got: %s", entry.Key, entry.Value)
+		}
+		if float64(value) < spec.Min || float64(value) > spec.Max {
+			return newIssue(SeverityWarning, "%s is usually in [%v, %v], got: %s", entry.Key, spec.Min, spec.Max, entry.Value)
+		}
+	case typeFloat:
+		value, err := strconv.ParseFloat(entry.Value, 64)
+		if err != nil {
+			return newIssue(SeverityError, "%s must be a number, got: %s", entry.Key, entry.Value)
+		}
+		if value < spec.Min || value > spec.Max {
+			return newIssue(SeverityWarning, "%s is usually in [%v, %v], got: %s", entry.Key, spec.Min, spec.Max, entry.Value)
+		}
+	case typeEnum:
+		for _, choice := range spec.Choices {
+			if strings.EqualFold(choice, entry.Value) {
+				return nil
+			}
+		}
+		return newIssue(SeverityWarning, "%s is usually one of %s, got: %s", entry.Key, strings.Join(spec.Choices, ", "), entry.Value)
+	case typeRules:
+		if !isRules(entry.Value) {
+			return newIssue(SeverityWarning, "%s is not a known rules name, short form or json, got: %s", entry.Key, entry.Value)
+		}
+	}
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "t", "1":
+		return true, nil
+	case "false", "f", "0":
+		return false, nil
+	}
+	return false, strconv.ErrSyntax
+}
+
+// SetValue sets the value of the key in the config file, the line of the key is replaced and the comments are kept.
+// the key is appended if it is not in the file.
+func SetValue(path string, key string, value string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	found := false
+	for i, line := range lines {
+		code := line
+		comment := ""
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			code = line[:idx]
+			comment = " " + line[idx:]
+		}
+		idx := strings.Index(code, "=")
+		if idx < 0 || strings.TrimSpace(code[:idx]) != key {
+			continue
+		}
+		lines[i] = fmt.Sprintf("%s = %s%s", key, value, comment)
+		found = true
+	}
+	if !found {
+		lines = append(lines, fmt.Sprintf("%s = %s", key, value))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), info.Mode())
+}
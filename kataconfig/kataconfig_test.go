@@ -0,0 +1,204 @@
+package kataconfig
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitOverride(t *testing.T) {
+	tests := []struct {
+		overrideConfig string
+		want           []string
+	}{
+		{"maxVisits=100", []string{"maxVisits=100"}},
+		{"analysisPVLen=30,numSearchThreads=30", []string{"analysisPVLen=30", "numSearchThreads=30"}},
+		{`rules={"ko":"SIMPLE","scoring":"AREA"},maxVisits=100`, []string{`rules={"ko":"SIMPLE","scoring":"AREA"}`, "maxVisits=100"}},
+		{"avoidMoves=[D4,Q16],maxVisits=100", []string{"avoidMoves=[D4,Q16]", "maxVisits=100"}},
+		{`logDir="a,b",maxVisits=100`, []string{`logDir="a,b"`, "maxVisits=100"}},
+		{`logDir='{',maxVisits=100`, []string{`logDir='{'`, "maxVisits=100"}},
+		{"a=1,,b=2,", []string{"a=1", "", "b=2", ""}},
+	}
+	for _, test := range tests {
+		if got := SplitOverride(test.overrideConfig); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SplitOverride(%q): got %q, want %q", test.overrideConfig, got, test.want)
+		}
+	}
+}
+
+func TestParseOverride(t *testing.T) {
+	entries, issues := ParseOverride(` maxVisits = 100 , rules={"ko":"SIMPLE","scoring":"AREA","tax":"NONE"},numSearchThreads=8`)
+	if len(issues) != 0 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+	want := []Entry{
+		{Key: "maxVisits", Value: "100", Source: OverrideSource},
+		{Key: "rules", Value: `{"ko":"SIMPLE","scoring":"AREA","tax":"NONE"}`, Source: OverrideSource},
+		{Key: "numSearchThreads", Value: "8", Source: OverrideSource},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %+v, want %+v", entries, want)
+	}
+
+	entries, issues = ParseOverride("maxVisits=100,novalue,maxVisits=200")
+	if len(entries) != 1 || entries[0].Value != "100" {
+		t.Errorf("got %+v, want only the first maxVisits", entries)
+	}
+	if len(issues) != 2 || !HasErrors(issues) {
+		t.Errorf("got %v, want the errors of the missing = and the duplicated key", issues)
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	tests := []struct {
+		key      string
+		value    string
+		severity string
+	}{
+		{"logSearchInfo", "true", ""},
+		{"logSearchInfo", "F", ""},
+		{"logSearchInfo", "yes", SeverityError},
+		{"numSearchThreads", "16", ""},
+		{"numSearchThreads", "1.5", SeverityError},
+		{"numSearchThreads", "0", SeverityWarning},
+		{"numSearchThreads", "", SeverityError},
+		{"playoutDoublingAdvantage", "-1.5", ""},
+		{"playoutDoublingAdvantage", "abc", SeverityError},
+		{"playoutDoublingAdvantage", "4", SeverityWarning},
+		{"koRule", "positional", ""},
+		{"koRule", "SUPERKO", SeverityWarning},
+		{"rules", "chinese", ""},
+		{"rules", "koPOSITIONALscoreAREAtaxNONEsui1", ""},
+		{"rules", `{"ko":"SIMPLE"}`, ""},
+		{"rules", "chess", SeverityWarning},
+		{"cudaDeviceToUseThread1", "1", ""},
+		{"noSuchKey", "1", SeverityWarning},
+		{"", "1", SeverityError},
+	}
+	for _, test := range tests {
+		issues := CheckValue(test.key, test.value)
+		severity := ""
+		if len(issues) > 0 {
+			severity = issues[0].Severity
+		}
+		if severity != test.severity || len(issues) > 1 {
+			t.Errorf("CheckValue(%q, %q): got %v, want severity %q", test.key, test.value, issues, test.severity)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	content := `# the gtp config
+logSearchInfo = false   # inline comment
+numSearchThreads=8
+
+maxVisits = 500
+this line has no equal sign
+numSearchThreads = 16
+rules = japanese
+`
+	config, issues, err := Parse(strings.NewReader(content), "gtp.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := config.Get("numSearchThreads"); value != "8" {
+		t.Errorf("numSearchThreads: got %q, want the first one 8", value)
+	}
+	if value, _ := config.Get("logSearchInfo"); value != "false" {
+		t.Errorf("logSearchInfo: got %q, want false", value)
+	}
+	var lines []int
+	for _, issue := range issues {
+		if issue.Severity != SeverityError || issue.Source != "gtp.cfg" {
+			t.Errorf("unexpected issue: %v", issue)
+		}
+		lines = append(lines, issue.Line)
+	}
+	if want := []int{6, 7}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("issue lines: got %v, want %v", lines, want)
+	}
+	keys := make([]string, 0)
+	for _, entry := range config.Entries() {
+		keys = append(keys, entry.Key)
+	}
+	if want := []string{"logSearchInfo", "numSearchThreads", "maxVisits", "rules"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys: got %q, want %q", keys, want)
+	}
+}
+
+func TestCheckMergesOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gtp.cfg")
+	if err := ioutil.WriteFile(path, []byte("maxVisits = 500\nnumSearchThreads = 8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	overrideConfig := "maxVisits=100,koRule=SUPERKO"
+	config, issues, err := Check(path, &overrideConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := config.Get("maxVisits"); value != "100" {
+		t.Errorf("maxVisits: got %q, want the override 100", value)
+	}
+	if len(issues) != 1 || issues[0].Source != OverrideSource || issues[0].Severity != SeverityWarning {
+		t.Errorf("got %v, want the warning of koRule in the override", issues)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		key     string
+		value   string
+		want    string
+	}{
+		{
+			name:    "replace",
+			content: "# threads\nnumSearchThreads = 8  # tuned\nmaxVisits = 500\n",
+			key:     "numSearchThreads",
+			value:   "16",
+			want:    "# threads\nnumSearchThreads = 16 # tuned\nmaxVisits = 500\n",
+		},
+		{
+			name:    "commented out key is kept",
+			content: "# numSearchThreads = 4\nmaxVisits = 500\n",
+			key:     "numSearchThreads",
+			value:   "16",
+			want:    "# numSearchThreads = 4\nmaxVisits = 500\nnumSearchThreads = 16\n",
+		},
+		{
+			name:    "prefix of another key",
+			content: "numSearchThreadsPerGPU = 2\n",
+			key:     "numSearchThreads",
+			value:   "16",
+			want:    "numSearchThreadsPerGPU = 2\nnumSearchThreads = 16\n",
+		},
+		{
+			name:    "no trailing newline",
+			content: "maxVisits=500",
+			key:     "maxVisits",
+			value:   "100",
+			want:    "maxVisits = 100\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gtp.cfg")
+			if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := SetValue(path, test.key, test.value); err != nil {
+				t.Fatal(err)
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != test.want {
+				t.Errorf("got %q, want %q", content, test.want)
+			}
+		})
+	}
+}
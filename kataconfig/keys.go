@@ -0,0 +1,183 @@
+package kataconfig
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	typeString = "string"
+	typeInt    = "int"
+	typeFloat  = "float"
+	typeBool   = "bool"
+	typeEnum   = "enum"
+	typeRules  = "rules"
+)
+
+// keySpec represents the spec of a known katago config key. the ranges and the choices are only what katago
+// documents or uses commonly, so the values out of them are warnings, and only the values katago cannot parse are errors.
+type keySpec struct {
+	Type    string
+	Min     float64
+	Max     float64
+	Choices []string
+}
+
+func intKey(min float64, max float64) keySpec {
+	return keySpec{Type: typeInt, Min: min, Max: max}
+}
+
+func floatKey(min float64, max float64) keySpec {
+	return keySpec{Type: typeFloat, Min: min, Max: max}
+}
+
+func enumKey(choices ...string) keySpec {
+	return keySpec{Type: typeEnum, Choices: choices}
+}
+
+var (
+	stringKey = keySpec{Type: typeString}
+	boolKey   = keySpec{Type: typeBool}
+	fp16Key   = enumKey("auto", "true", "false")
+)
+
+// knownKeys are the keys katago reads from the gtp and analysis configs
+var knownKeys = map[string]keySpec{
+	// logs
+	"logDir":                 stringKey,
+	"logDirDated":            stringKey,
+	"logFile":                stringKey,
+	"logAllGTPCommunication": boolKey,
+	"logSearchInfo":          boolKey,
+	"logToStderr":            boolKey,
+	"logTimeStamp":           boolKey,
+	"logAllRequests":         boolKey,
+	"logAllResponses":        boolKey,
+	"logErrorsAndWarnings":   boolKey,
+
+	// analysis
+	"analysisPVLen":                intKey(1, 1000),
+	"reportAnalysisWinratesAs":     enumKey("BLACK", "WHITE", "SIDETOMOVE"),
+	"analysisWideRootNoise":        floatKey(0, 5),
+	"analysisIgnorePreRootHistory": boolKey,
+	"numAnalysisThreads":           intKey(1, 16384),
+
+	// rules
+	"rules":                  {Type: typeRules},
+	"koRule":                 enumKey("SIMPLE", "POSITIONAL", "SITUATIONAL", "SPIGHT"),
+	"scoringRule":            enumKey("AREA", "TERRITORY"),
+	"taxRule":                enumKey("NONE", "SEKI", "ALL"),
+	"multiStoneSuicideLegal": boolKey,
+	"hasButton":              boolKey,
+	"whiteHandicapBonus":     enumKey("0", "N", "N-1"),
+	"friendlyPassOk":         boolKey,
+
+	// board size
+	"defaultBoardSize":         intKey(2, 37),
+	"defaultBoardXSize":        intKey(2, 37),
+	"defaultBoardYSize":        intKey(2, 37),
+	"maxBoardXSizeForNNBuffer": intKey(2, 37),
+	"maxBoardYSizeForNNBuffer": intKey(2, 37),
+	"requireMaxBoardSize":      boolKey,
+
+	// bot behavior
+	"allowResignation":                             boolKey,
+	"resignThreshold":                              floatKey(-1, 0),
+	"resignConsecTurns":                            intKey(1, 100),
+	"resignMinScoreDifference":                     floatKey(0, 1000),
+	"ponderingEnabled":                             boolKey,
+	"maxTimePondering":                             floatKey(0, 1e20),
+	"lagBuffer":                                    floatKey(0, 3600),
+	"searchFactorAfterOnePass":                     floatKey(0, 1),
+	"searchFactorAfterTwoPass":                     floatKey(0, 1),
+	"searchFactorWhenWinning":                      floatKey(0, 1),
+	"searchFactorWhenWinningThreshold":             floatKey(0, 1),
+	"playoutDoublingAdvantage":                     floatKey(-3, 3),
+	"playoutDoublingAdvantagePla":                  enumKey("BLACK", "WHITE"),
+	"dynamicPlayoutDoublingAdvantageCapPerOppLead": floatKey(0, 0.5),
+	"avoidMYTDaggerHack":                           boolKey,
+	"antiMirror":                                   boolKey,
+	"conservativePass":                             boolKey,
+	"preventCleanupPhase":                          boolKey,
+	"ignorePreRootHistory":                         boolKey,
+
+	// search limits
+	"maxVisits":            intKey(1, 1e18),
+	"maxPlayouts":          intKey(1, 1e18),
+	"maxTime":              floatKey(0, 1e20),
+	"maxVisitsPondering":   intKey(1, 1e18),
+	"maxPlayoutsPondering": intKey(1, 1e18),
+	"numSearchThreads":     intKey(1, 4096),
+
+	// search params
+	"chosenMoveTemperatureEarly":    floatKey(0, 5),
+	"chosenMoveTemperature":         floatKey(0, 5),
+	"chosenMoveTemperatureHalflife": floatKey(0.1, 100000),
+	"rootPolicyTemperature":         floatKey(0.01, 100),
+	"rootPolicyTemperatureEarly":    floatKey(0.01, 100),
+	"wideRootNoise":                 floatKey(0, 5),
+	"cpuctExploration":              floatKey(0, 10),
+	"cpuctExplorationLog":           floatKey(0, 10),
+	"fpuReductionMax":               floatKey(0, 2),
+	"rootFpuReductionMax":           floatKey(0, 2),
+	"valueWeightExponent":           floatKey(0, 1),
+	"subtreeValueBiasFactor":        floatKey(0, 1),
+	"useGraphSearch":                boolKey,
+
+	// neural net
+	"nnMaxBatchSize":             intKey(1, 65536),
+	"nnCacheSizePowerOfTwo":      intKey(0, 48),
+	"nnMutexPoolSizePowerOfTwo":  intKey(-1, 24),
+	"numNNServerThreadsPerModel": intKey(1, 1024),
+	"nnRandomize":                boolKey,
+	"nnRandSeed":                 stringKey,
+	"homeDataDir":                stringKey,
+
+	// backends
+	"cudaDeviceToUse":          intKey(0, 1023),
+	"cudaUseFP16":              fp16Key,
+	"cudaUseNHWC":              fp16Key,
+	"trtDeviceToUse":           intKey(0, 1023),
+	"openclDeviceToUse":        intKey(0, 1023),
+	"openclUseFP16":            fp16Key,
+	"openclReTunePerBoardSize": boolKey,
+	"numEigenThreadsPerModel":  intKey(1, 1024),
+}
+
+// ruleNames are the named rules katago accepts, besides the short form and the json form
+var ruleNames = []string{
+	"tromp-taylor", "tromp_taylor", "tromptaylor",
+	"chinese", "chinese-ogs", "chinese_ogs", "chinese-kgs", "chinese_kgs",
+	"japanese", "korean", "aga", "bga", "french",
+	"new-zealand", "new_zealand", "newzealand",
+	"aga-button", "aga_button", "agabutton",
+	"stone-scoring", "stone_scoring", "stonescoring",
+	"ancient-area", "ancient-territory",
+}
+
+// shortRulesPattern matches the short form of the rules, like koPOSITIONALscoreAREAtaxNONEsui1
+var shortRulesPattern = regexp.MustCompile(`(?i)^ko[a-z]+(score|tax|sui|button|fpok|whb)[a-z0-9-]*$`)
+
+// isRules checks if the value looks like the rules katago accepts: a name, the short form or the json form
+func isRules(value string) bool {
+	for _, name := range ruleNames {
+		if strings.EqualFold(name, value) {
+			return true
+		}
+	}
+	return strings.HasPrefix(value, "{") || shortRulesPattern.MatchString(value)
+}
+
+// indexedKeyPattern matches the per server thread device keys, like cudaDeviceToUseThread0
+var indexedKeyPattern = regexp.MustCompile(`^(cudaDeviceToUse|trtDeviceToUse|openclDeviceToUse)Thread[0-9]+$`)
+
+func lookupKey(key string) (keySpec, bool) {
+	spec, ok := knownKeys[key]
+	if ok {
+		return spec, true
+	}
+	if indexedKeyPattern.MatchString(key) {
+		return intKey(0, 1023), true
+	}
+	return keySpec{}, false
+}
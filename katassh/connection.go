@@ -0,0 +1,76 @@
+package katassh
+
+import (
+	"sync"
+
+	"github.com/kinfkong/ikatago-client/model"
+	"golang.org/x/crypto/ssh"
+)
+
+// Connection is a ssh connection shared by multiple sessions. it is dialed by the first session,
+// and closed when the last session is finished.
+type Connection struct {
+	sshoptions model.SSHOptions
+	lock       sync.Mutex
+	sshClient  *ssh.Client
+	// refs counts the sessions using each ssh client, the replaced client is closed when its last session finishes
+	refs   map[*ssh.Client]int
+	broken bool
+}
+
+// NewConnection creates the shared connection, it does not connect until a session needs it
+func NewConnection(sshoptions model.SSHOptions) *Connection {
+	return &Connection{
+		sshoptions: sshoptions,
+		refs:       make(map[*ssh.Client]int),
+	}
+}
+
+// acquire gets the ssh client, and dials if not connected
+func (connection *Connection) acquire() (*ssh.Client, error) {
+	connection.lock.Lock()
+	defer connection.lock.Unlock()
+	if connection.sshClient == nil {
+		sshClient, err := dial(connection.sshoptions)
+		if err != nil {
+			return nil, err
+		}
+		connection.sshClient = sshClient
+		if connection.broken {
+			reconnectsTotal.Inc()
+			connection.broken = false
+		}
+	}
+	connection.refs[connection.sshClient]++
+	return connection.sshClient, nil
+}
+
+// release releases the ssh client, and closes it if no session is using it
+func (connection *Connection) release(sshClient *ssh.Client) {
+	connection.lock.Lock()
+	defer connection.lock.Unlock()
+	connection.refs[sshClient]--
+	if connection.refs[sshClient] > 0 {
+		return
+	}
+	delete(connection.refs, sshClient)
+	sshClient.Close()
+	if sshClient == connection.sshClient {
+		connection.sshClient = nil
+	}
+}
+
+// discard checks the ssh client after a session fails to be created on it. if the client does not answer a keepalive,
+// it is dead and replaced, so that the next session dials again. the sessions holding it still release it.
+// a live client is kept, since the other sessions are running on it.
+func (connection *Connection) discard(sshClient *ssh.Client) {
+	if _, _, err := sshClient.SendRequest("keepalive@ikatago.com", true, nil); err == nil {
+		return
+	}
+	connection.lock.Lock()
+	defer connection.lock.Unlock()
+	if sshClient == connection.sshClient {
+		connection.sshClient = nil
+		connection.broken = true
+	}
+}
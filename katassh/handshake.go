@@ -0,0 +1,60 @@
+package katassh
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/kinfkong/ikatago-client/model"
+	"golang.org/x/crypto/ssh"
+)
+
+// HandshakeResult represents the result of the ssh handshake and the authentication
+type HandshakeResult struct {
+	ServerVersion string
+	Handshake     time.Duration
+	Auth          time.Duration
+	HandshakeErr  error
+	AuthErr       error
+}
+
+// CheckHandshake connects to the ssh server, and checks the handshake and the authentication separately
+func CheckHandshake(sshoptions model.SSHOptions) *HandshakeResult {
+	result := &HandshakeResult{}
+	addr := net.JoinHostPort(sshoptions.Host, strconv.Itoa(sshoptions.Port))
+	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	if err != nil {
+		result.HandshakeErr = err
+		return result
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	start := time.Now()
+	handshaked := false
+	config := &ssh.ClientConfig{
+		User: sshoptions.User,
+		Auth: []ssh.AuthMethod{ssh.Password(sshoptions.Password)},
+		// the host key is checked after the key exchange, before the authentication
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			handshaked = true
+			result.Handshake = time.Since(start)
+			return nil
+		},
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		if handshaked {
+			result.Auth = time.Since(start) - result.Handshake
+			result.AuthErr = err
+		} else {
+			result.Handshake = time.Since(start)
+			result.HandshakeErr = err
+		}
+		return result
+	}
+	result.Auth = time.Since(start) - result.Handshake
+	result.ServerVersion = string(c.ServerVersion())
+	ssh.NewClient(c, chans, reqs).Close()
+	return result
+}
@@ -0,0 +1,13 @@
+package katassh
+
+import "github.com/kinfkong/ikatago-client/metrics"
+
+var (
+	dialsTotal      = metrics.NewCounterVec("ikatago_ssh_dials_total", "The number of ssh dials by result.", "result")
+	reconnectsTotal = metrics.NewCounterVec("ikatago_ssh_reconnects_total", "The number of times the shared ssh connection is dialed again after it is broken.")
+	bytesTotal      = metrics.NewCounterVec("ikatago_bytes_total", "The bytes transmitted by the katago sessions. received is from the server, the output is labeled decoded after decompression, uncompressed with --no-compress, or raw with the raw data.", "stream")
+)
+
+func init() {
+	reconnectsTotal.Add(0)
+}
@@ -1,13 +1,20 @@
 package katassh
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kinfkong/ikatago-client/model"
@@ -15,13 +22,65 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// ErrStopped is returned when the session is stopped before the command is started
+var ErrStopped = errors.New("stopped")
+
+var sha256Pattern = regexp.MustCompile(`\b[0-9a-f]{64}\b`)
+
+// uploadCacheTTL is how long an uploaded config is trusted to be on the server, the server may be restarted with
+// a fresh disk, like a new colab session on the same address
+const uploadCacheTTL = 12 * time.Hour
+
+// KataSSHSession represents a ssh session to the server. it can be stopped from any goroutine.
 type KataSSHSession struct {
-	Stopped bool
-	Session *ssh.Session
+	// OnConnected is called when the ssh connection is established
+	OnConnected func()
+	// Connection is the shared ssh connection. the session dials its own connection if it is nil.
+	Connection *Connection
+	// NoCompress tells that the server does not compress the output, it labels the output in the metrics
+	NoCompress bool
+	// UploadCacheDir records the configs uploaded to the servers, so that the later uploads of the same content,
+	// even from other processes, are skipped. the uploads are not recorded if it is empty.
+	UploadCacheDir string
+
+	lock      sync.Mutex
+	stopped   bool
+	sshClient *ssh.Client
+	session   *ssh.Session
+	traffic   trafficCounters
 }
 
-// RunSSH runs the ssh command
-func (kataSSHSession *KataSSHSession) RunSSH(sshoptions model.SSHOptions, cmd string, stdinReader io.Reader, stderrWriter io.Writer, outputWriter io.Writer) error {
+// Traffic represents the bytes transmitted by a session
+type Traffic struct {
+	// Sent is the bytes of the input sent to katago
+	Sent int64 `json:"sent"`
+	// Received is the bytes received from the server, compressed unless --no-compress
+	Received int64 `json:"received"`
+	// Decoded is the bytes of the output after decompression
+	Decoded int64 `json:"decoded"`
+}
+
+type trafficCounters struct {
+	sent     int64
+	received int64
+	decoded  int64
+}
+
+type countingReader struct {
+	reader  io.Reader
+	counter *int64
+	stream  string
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	atomic.AddInt64(r.counter, int64(n))
+	bytesTotal.Add(float64(n), r.stream)
+	return n, err
+}
+
+// dial connects to the ssh server
+func dial(sshoptions model.SSHOptions) (*ssh.Client, error) {
 	config := &ssh.ClientConfig{
 		Timeout:         30 * time.Second,
 		User:            sshoptions.User,
@@ -32,20 +91,77 @@ func (kataSSHSession *KataSSHSession) RunSSH(sshoptions model.SSHOptions, cmd st
 	addr := fmt.Sprintf("%s:%d", sshoptions.Host, sshoptions.Port)
 	sshClient, err := ssh.Dial("tcp", addr, config)
 	if err != nil {
-		return err
+		dialsTotal.Inc("failure")
+		log.Printf("DEBUG failed to connect to %s with user: %s : %v", addr, sshoptions.User, err)
+		return nil, err
+	}
+	dialsTotal.Inc("success")
+	return sshClient, nil
+}
+
+// connect gets the ssh client from the shared connection, or dials a new one. release must be called when the session finishes.
+func (kataSSHSession *KataSSHSession) connect(sshoptions model.SSHOptions) (*ssh.Client, func(), error) {
+	if kataSSHSession.Connection == nil {
+		sshClient, err := dial(sshoptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sshClient, func() { sshClient.Close() }, nil
+	}
+	sshClient, err := kataSSHSession.Connection.acquire()
+	if err != nil {
+		return nil, nil, err
 	}
-	defer sshClient.Close()
+	return sshClient, func() { kataSSHSession.Connection.release(sshClient) }, nil
+}
 
+// newSession creates the session on the ssh client. the shared connection is replaced if it is dead.
+func (kataSSHSession *KataSSHSession) newSession(sshClient *ssh.Client) (*ssh.Session, error) {
 	session, err := sshClient.NewSession()
+	if err != nil && kataSSHSession.Connection != nil {
+		kataSSHSession.Connection.discard(sshClient)
+	}
+	return session, err
+}
+
+// attach attaches the connection and session to be closed by Stop, returns false if it has been stopped.
+// the shared connection is not closed by Stop, since it is used by other sessions.
+func (kataSSHSession *KataSSHSession) attach(sshClient *ssh.Client, session *ssh.Session) bool {
+	kataSSHSession.lock.Lock()
+	defer kataSSHSession.lock.Unlock()
+	if kataSSHSession.stopped {
+		return false
+	}
+	if kataSSHSession.Connection == nil {
+		kataSSHSession.sshClient = sshClient
+	}
+	kataSSHSession.session = session
+	return true
+}
+
+// IsStopped checks if the session has been stopped
+func (kataSSHSession *KataSSHSession) IsStopped() bool {
+	kataSSHSession.lock.Lock()
+	defer kataSSHSession.lock.Unlock()
+	return kataSSHSession.stopped
+}
+
+// RunSSH runs the ssh command
+func (kataSSHSession *KataSSHSession) RunSSH(sshoptions model.SSHOptions, cmd string, stdinReader io.Reader, stderrWriter io.Writer, outputWriter io.Writer) error {
+	sshClient, release, err := kataSSHSession.connect(sshoptions)
 	if err != nil {
 		return err
 	}
-	defer session.Close()
-	if kataSSHSession.Stopped {
-		return nil
+	defer release()
+
+	session, err := kataSSHSession.newSession(sshClient)
+	if err != nil {
+		return err
 	}
-	kataSSHSession.Session = session
 	defer session.Close()
+	if !kataSSHSession.attach(sshClient, session) {
+		return ErrStopped
+	}
 	session.Stderr = stderrWriter
 	session.Stdin = stdinReader
 	session.Stdout = outputWriter
@@ -59,128 +175,206 @@ func (kataSSHSession *KataSSHSession) RunSSH(sshoptions model.SSHOptions, cmd st
 	return nil
 }
 
-// RunSCP runs the scp command
-func (kataSSHSession *KataSSHSession) RunSCP(sshoptions model.SSHOptions, localFile string, serverLocationOptions string) error {
+// RunSCP uploads the local config file to the server, and returns the name of the config on the server.
+// the config is named by its content, like gtp_example-0123456789ab.cfg. uploading the same content to the same server
+// again is skipped if it is recorded in the UploadCacheDir.
+// the size and sha256 of the content are sent with the command, and the server must echo the sha256 back.
+// the legacy server which does not know --size and --sha256 cannot verify the content, it is uploaded without them.
+func (kataSSHSession *KataSSHSession) RunSCP(sshoptions model.SSHOptions, localFile string, serverLocationOptions string, stderrWriter io.Writer) (string, error) {
+	content, err := readConfigFile(localFile)
+	if err != nil {
+		return "", err
+	}
+	checksum := sha256.Sum256(content)
+	sha256Hex := hex.EncodeToString(checksum[:])
+	remoteName := remoteConfigName(localFile, sha256Hex)
+	cacheKey := fmt.Sprintf("%s@%s:%d/%s%s", sshoptions.User, sshoptions.Host, sshoptions.Port, remoteName, serverLocationOptions)
+	if kataSSHSession.isUploaded(cacheKey) {
+		log.Printf("DEBUG config %s has been uploaded as %s, skipped\n", localFile, remoteName)
+		return remoteName, nil
+	}
+
+	cmd := fmt.Sprintf("scp-config %s --size %d --sha256 %s%s", remoteName, len(content), sha256Hex, serverLocationOptions)
+	log.Printf("DEBUG running scp command: %s\n", cmd)
+	output, errOutput, err := kataSSHSession.runUpload(sshoptions, cmd, content, stderrWriter)
+	if err != nil && IsUnknownFlagError(err, output+errOutput, "size", "sha256") {
+		legacyCmd := fmt.Sprintf("scp-config %s%s", remoteName, serverLocationOptions)
+		log.Printf("DEBUG the server does not know --size and --sha256, retry with the legacy scp command: %s\n", legacyCmd)
+		_, _, err = kataSSHSession.runUpload(sshoptions, legacyCmd, content, stderrWriter)
+		if err != nil {
+			return "", err
+		}
+		log.Printf("WARNING the legacy server cannot verify the checksum of the config %s\n", remoteName)
+		kataSSHSession.markUploaded(cacheKey)
+		return remoteName, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	confirmed := sha256Pattern.FindAllString(output, -1)
+	if len(confirmed) == 0 {
+		log.Printf("ERROR the server did not confirm the checksum of the config %s\n", remoteName)
+		return "", errors.New("checksum_not_confirmed")
+	} else if !containsString(confirmed, sha256Hex) {
+		log.Printf("ERROR checksum mismatch of the uploaded config %s, expected: %s, got: %s\n", remoteName, sha256Hex, strings.Join(confirmed, ","))
+		return "", errors.New("checksum_mismatch")
+	}
+	kataSSHSession.markUploaded(cacheKey)
+	return remoteName, nil
+}
+
+// runUpload runs the upload command with the content as stdin, and returns the stdout and the stderr of the command
+func (kataSSHSession *KataSSHSession) runUpload(sshoptions model.SSHOptions, cmd string, content []byte, stderrWriter io.Writer) (string, string, error) {
+	output := bytes.NewBuffer(nil)
+	errOutput := bytes.NewBuffer(nil)
+	var stdoutWriter io.Writer = output
+	var errWriter io.Writer = errOutput
+	if stderrWriter != nil {
+		stdoutWriter = io.MultiWriter(output, stderrWriter)
+		errWriter = io.MultiWriter(errOutput, stderrWriter)
+	}
+	// the ssh session sends EOF once the whole content is written
+	err := kataSSHSession.RunSSH(sshoptions, cmd, bytes.NewReader(content), errWriter, stdoutWriter)
+	return output.String(), errOutput.String(), err
+}
+
+// IsUnknownFlagError checks if the remote command exits because the server does not know one of the flags,
+// output is the output of the command. the errors before the command runs, like the dial or auth errors, are not.
+func IsUnknownFlagError(err error, output string, flags ...string) bool {
+	var exitError *ssh.ExitError
+	if !errors.As(err, &exitError) {
+		return false
+	}
+	output = strings.ToLower(output)
+	if !strings.Contains(output, "unknown flag") && !strings.Contains(output, "unknown option") && !strings.Contains(output, "flag provided but not defined") {
+		return false
+	}
+	for _, flag := range flags {
+		if strings.Contains(output, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteConfigName(localFile string, sha256Hex string) string {
+	basefileName := filepath.Base(localFile)
+	return strings.TrimSuffix(basefileName, ".cfg") + "-" + sha256Hex[:12] + ".cfg"
+}
+
+func readConfigFile(localFile string) ([]byte, error) {
 	// check file existence
 	if !utils.FileExists(localFile) {
 		log.Printf("ERROR config file not found: %s\n", localFile)
-		return errors.New("file_not_found")
+		return nil, errors.New("file_not_found")
 	}
 
 	basefileName := filepath.Base(localFile)
 	if !strings.HasSuffix(basefileName, ".cfg") {
 		log.Printf("ERROR config file name must ends with .cfg")
-		return errors.New("invalid_file_extension")
+		return nil, errors.New("invalid_file_extension")
 	}
 	fileSize, err := utils.GetFileSize(localFile)
 	if err != nil {
 		log.Printf("ERROR cannot get file size: %s\n", localFile)
-		return errors.New("io_error")
+		return nil, errors.New("io_error")
 	}
 	if fileSize >= 1024*100 {
 		log.Printf("ERROR config file: %s is too large: %v\n", localFile, fileSize)
-		return errors.New("file_too_large")
-	}
-	config := &ssh.ClientConfig{
-		Timeout:         30 * time.Second,
-		User:            sshoptions.User,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		return nil, errors.New("file_too_large")
 	}
-
-	config.Auth = []ssh.AuthMethod{ssh.Password(sshoptions.Password)}
-	addr := fmt.Sprintf("%s:%d", sshoptions.Host, sshoptions.Port)
-	sshClient, err := ssh.Dial("tcp", addr, config)
+	content, err := ioutil.ReadFile(localFile)
 	if err != nil {
-		return err
+		log.Printf("ERROR cannot open file: %s\n", localFile)
+		return nil, errors.New("io_error")
 	}
-	defer sshClient.Close()
+	return content, nil
+}
 
-	session, err := sshClient.NewSession()
-	if err != nil {
-		return err
+// uploadCacheFile returns the file recording the upload, it is named by the hash of the cache key,
+// so that the processes uploading at the same time never write the same file with different content
+func (kataSSHSession *KataSSHSession) uploadCacheFile(cacheKey string) string {
+	if len(kataSSHSession.UploadCacheDir) == 0 {
+		return ""
 	}
-	defer session.Close()
-	if kataSSHSession.Stopped {
-		return nil
+	hash := sha256.Sum256([]byte(cacheKey))
+	return filepath.Join(kataSSHSession.UploadCacheDir, hex.EncodeToString(hash[:]))
+}
+
+func (kataSSHSession *KataSSHSession) isUploaded(cacheKey string) bool {
+	cacheFile := kataSSHSession.uploadCacheFile(cacheKey)
+	if len(cacheFile) == 0 {
+		return false
 	}
-	kataSSHSession.Session = session
-	defer session.Close()
-	session.Stdout = os.Stdout
-	session.Stderr = os.Stderr
-	// session.Stdin = os.Stdin
-	log.Printf("DEBUG running scp command: %s %s\n", "scp-config", localFile)
-	writer, err := session.StdinPipe()
+	info, err := os.Stat(cacheFile)
 	if err != nil {
-		return err
+		return false
 	}
-	f, err := os.Open(localFile)
-	if err != nil {
-		log.Printf("ERROR cannot open file: %s\n", localFile)
-		return err
+	return time.Since(info.ModTime()) < uploadCacheTTL
+}
+
+func (kataSSHSession *KataSSHSession) markUploaded(cacheKey string) {
+	cacheFile := kataSSHSession.uploadCacheFile(cacheKey)
+	if len(cacheFile) == 0 {
+		return
 	}
-	_, err = io.Copy(writer, f)
-	if err != nil {
-		log.Printf("ERROR failed to send file: %s\n", localFile)
-		return err
+	err := os.MkdirAll(kataSSHSession.UploadCacheDir, 0700)
+	if err == nil {
+		err = ioutil.WriteFile(cacheFile, []byte(cacheKey+"\n"), 0600)
 	}
-	go func() {
-		time.Sleep(3 * time.Second)
-		writer.Close()
-	}()
-	if len(serverLocationOptions) > 0 {
-		log.Printf("DEBUG running scp command: %s %s%s\n", "scp-config", basefileName, serverLocationOptions)
-		err = session.Run(fmt.Sprintf("scp-config %s%s", basefileName, serverLocationOptions))
-	} else {
-		log.Printf("DEBUG running scp command: %s %s\n", "scp-config", basefileName)
-		err = session.Run(fmt.Sprintf("scp-config %s", basefileName))
+	if err != nil {
+		log.Printf("WARNING failed to record the uploaded config: %v\n", err)
 	}
+}
 
-	if err != nil {
-		return err
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
 // RunKatago runs the ssh as katago
 func (kataSSHSession *KataSSHSession) RunKatago(sshoptions model.SSHOptions, cmd string, inputReader io.Reader, outputWriter io.Writer, stderrWriter io.Writer, useRawData bool, onReady func()) error {
-	config := &ssh.ClientConfig{
-		Timeout:         30 * time.Second,
-		User:            sshoptions.User,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-
-	config.Auth = []ssh.AuthMethod{ssh.Password(sshoptions.Password)}
-	addr := fmt.Sprintf("%s:%d", sshoptions.Host, sshoptions.Port)
-	sshClient, err := ssh.Dial("tcp", addr, config)
+	sshClient, release, err := kataSSHSession.connect(sshoptions)
 	if err != nil {
-		log.Printf("DEBUG failed to connect to %s with password: %s : %v", addr, sshoptions.Password, err)
 		return err
 	}
-	defer sshClient.Close()
+	defer release()
+	if kataSSHSession.OnConnected != nil {
+		kataSSHSession.OnConnected()
+	}
 
-	session, err := sshClient.NewSession()
+	session, err := kataSSHSession.newSession(sshClient)
 	if err != nil {
 		log.Printf("DEBUG failed to create session: %v", err)
 		return err
 	}
 	defer session.Close()
-	if kataSSHSession.Stopped {
+	if !kataSSHSession.attach(sshClient, session) {
 		log.Printf("DEBUG session has been stopped before running")
-		return nil
+		return ErrStopped
 	}
-	kataSSHSession.Session = session
+	done := make(chan struct{})
+	defer close(done)
 
 	session.Stderr = stderrWriter
-	session.Stdin = inputReader
-	reader, err := session.StdoutPipe()
+	session.Stdin = &countingReader{reader: inputReader, counter: &kataSSHSession.traffic.sent, stream: "sent"}
+	stdout, err := session.StdoutPipe()
 	if err != nil {
 		log.Printf("DEBUG pipe stdout: %v", err)
 		return err
 	}
+	reader := &countingReader{reader: stdout, counter: &kataSSHSession.traffic.received, stream: "received"}
+	readerDone := make(chan struct{})
 	go func() {
+		defer close(readerDone)
 		buf := make([]byte, 4096)
 		var theReader io.Reader = nil
 		var gtpReader *GTPReader = nil
+		outputStream := outputStreamName(useRawData, kataSSHSession.NoCompress)
 		if !useRawData {
 			gtpReader = NewGTPReader(reader)
 		} else {
@@ -196,6 +390,8 @@ func (kataSSHSession *KataSSHSession) RunKatago(sshoptions model.SSHOptions, cmd
 				n, err = theReader.Read(buf)
 			}
 
+			atomic.AddInt64(&kataSSHSession.traffic.decoded, int64(n))
+			bytesTotal.Add(float64(n), outputStream)
 			outputWriter.Write(buf[:n])
 			if err != nil {
 				if err == io.EOF {
@@ -211,32 +407,83 @@ func (kataSSHSession *KataSSHSession) RunKatago(sshoptions model.SSHOptions, cmd
 	// keep alive
 	go func() {
 		for {
-			if kataSSHSession.Stopped {
-				break
-			}
 			_, err := session.SendRequest("keepalive@ikatago.com", true, nil)
 			if err != nil {
-				break
+				return
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(15 * time.Second):
 			}
-			time.Sleep(15 * time.Second)
 		}
 	}()
 
 	//log.Printf("DEBUG running equal commad: ssh -p %d %s@%s %s\n", sshoptions.Port, sshoptions.User, sshoptions.Host, cmd)
+	err = session.Start(cmd)
+	if err != nil {
+		return err
+	}
 	if onReady != nil {
 		onReady()
 	}
-	err = session.Run(cmd)
+	err = session.Wait()
+	// all the output has been written when the session finishes
+	<-readerDone
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// outputStreamName returns the stream label of the output in the metrics. the output is only decoded from
+// the compressed data, it is the same bytes as received with the raw data or --no-compress.
+func outputStreamName(useRawData bool, noCompress bool) string {
+	if useRawData {
+		return "raw"
+	}
+	if noCompress {
+		return "uncompressed"
+	}
+	return "decoded"
+}
+
+// Traffic returns the bytes transmitted by the session so far
+func (kataSSHSession *KataSSHSession) Traffic() Traffic {
+	return Traffic{
+		Sent:     atomic.LoadInt64(&kataSSHSession.traffic.sent),
+		Received: atomic.LoadInt64(&kataSSHSession.traffic.received),
+		Decoded:  atomic.LoadInt64(&kataSSHSession.traffic.decoded),
+	}
+}
+
+// Ping sends a keepalive request on the running session, and returns the round trip time
+func (kataSSHSession *KataSSHSession) Ping() (time.Duration, error) {
+	kataSSHSession.lock.Lock()
+	session := kataSSHSession.session
+	kataSSHSession.lock.Unlock()
+	if session == nil {
+		return 0, errors.New("not_connected")
+	}
+	start := time.Now()
+	_, err := session.SendRequest("keepalive@ikatago.com", true, nil)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// Stop stops the session, it is safe to be called from any goroutine and more than once
 func (kataSSHSession *KataSSHSession) Stop() {
-	kataSSHSession.Stopped = true
-	if kataSSHSession.Session != nil {
-		kataSSHSession.Session.Close()
-		kataSSHSession.Session = nil
+	kataSSHSession.lock.Lock()
+	defer kataSSHSession.lock.Unlock()
+	kataSSHSession.stopped = true
+	if kataSSHSession.session != nil {
+		kataSSHSession.session.Close()
+		kataSSHSession.session = nil
+	}
+	if kataSSHSession.sshClient != nil {
+		kataSSHSession.sshClient.Close()
+		kataSSHSession.sshClient = nil
 	}
 }
@@ -4,12 +4,19 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/kinfkong/ikatago-client/client"
+	"github.com/kinfkong/ikatago-client/config"
+	"github.com/kinfkong/ikatago-client/credentials"
+	// registers the shell command
+	_ "github.com/kinfkong/ikatago-client/gtpshell"
 	"github.com/kinfkong/ikatago-client/ikatagosdk"
+	"github.com/kinfkong/ikatago-client/metrics"
 	"github.com/kinfkong/ikatago-client/model"
+	"github.com/kinfkong/ikatago-client/tracing"
 	"github.com/kinfkong/ikatago-client/utils"
 )
 
@@ -49,20 +56,59 @@ func TestSDK() {
 
 }
 
+func init() {
+	client.RegisterCommand(&client.Command{Name: "login", Description: "Saves the password of the --username on the --platform", Run: runCredentialsCommand})
+	client.RegisterCommand(&client.Command{Name: "logout", Description: "Deletes the saved password of the --username on the --platform", Run: runCredentialsCommand})
+}
+
 func main() {
 	l := log.New(os.Stderr, "", 0)
 	fmt.Fprintln(os.Stderr, "ikatago version: ", AppVersion)
 	// parse args
-	subCommands, err := flags.Parse(&opts)
+	parsedOpts, subCommands, err := config.ParseArgs(os.Args[1:])
 	if err != nil {
-		log.Fatal("Cannot parse args: ", err)
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			client.WriteCommands(os.Stdout)
+			return
+		}
+		l.Printf("Cannot parse args: %v", err)
+		os.Exit(client.ExitCodeUsage)
 	}
+	opts = *parsedOpts
 	defaultWorld := utils.WorldURL
 	if opts.World == nil {
 		opts.World = &defaultWorld
 	}
 	l.Printf("DEBUG the world is: %s\n", *opts.World)
 	l.Printf("DEBUG Platform: [%s] User: [%s]\n", opts.Platform, opts.Username)
+	if opts.MetricsListen != nil {
+		go func() {
+			err := metrics.ListenAndServe(*opts.MetricsListen)
+			if err != nil {
+				l.Printf("ERROR failed to serve the metrics: %v\n", err)
+			}
+		}()
+	}
+	command := client.FindCommand(opts.Command)
+	if command == nil {
+		l.Printf("Unknown command: [%s], the commands are:\n", opts.Command)
+		client.WriteCommands(os.Stderr)
+		os.Exit(client.ExitCodeUsage)
+	}
+	// run-katago logs in with the balanced profiles instead
+	balanced := opts.Command == "run-katago" && opts.BalanceProfiles != nil
+	if command.Login && !balanced {
+		err = credentials.Resolve(&opts, true)
+		if err != nil {
+			l.Printf("Failed to resolve the password. %v", err)
+			os.Exit(client.ExitCodeFailure)
+		}
+		err = client.CheckLoginOptions(&opts)
+		if err != nil {
+			l.Printf("%v", err)
+			os.Exit(client.CommandExitCode(err))
+		}
+	}
 	remoteClient, err := client.NewClient(client.Options{
 		World:      *opts.World,
 		Platform:   opts.Platform,
@@ -76,65 +122,130 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to create client.", err)
 	}
-	if opts.Command == "run-katago" {
-		sessionResult, err := remoteClient.RunKatago(client.RunKatagoOptions{
-			NoCompress:         opts.NoCompress,
-			RefreshInterval:    opts.RefreshInterval,
-			TransmitMoveNum:    opts.TransmitMoveNum,
-			KataLocalConfig:    opts.KataLocalConfig,
-			KataOverrideConfig: opts.KataOverrideConfig,
-			KataConfig:         opts.KataConfig,
-			KataWeight:         opts.KataWeight,
-			KataName:           opts.KataName,
-			ExtraInfo:          opts.ExtraInfo,
-			ClientID:           opts.ClientID,
-			UseRawData:         false,
-		}, subCommands, os.Stdin, os.Stdout, os.Stderr, nil)
+	var tracer *tracing.Tracer
+	if opts.TraceFile != nil || opts.TraceOTLP != nil {
+		tracer = tracing.NewTracer("ikatago-client", opts.Command)
+		tracer.Root().SetAttribute("platform", opts.Platform)
+		if opts.TraceFile != nil {
+			tracer.ExportToFile(*opts.TraceFile)
+		}
+		if opts.TraceOTLP != nil {
+			tracer.ExportToOTLP(*opts.TraceOTLP)
+		}
+		remoteClient.SetTracer(tracer)
+	}
+	var balancer *client.Balancer
+	if balanced {
+		balancer, err = newBalancer()
 		if err != nil {
-			l.Printf("ERROR run katago failed: %v", err)
-			l.Fatal("Failed to run katago.", err)
-		}
-		sessionResult.Wait()
-	} else if opts.Command == "preload-katago" {
-		sessionResult, err := remoteClient.PreloadKatago(client.RunKatagoOptions{
-			NoCompress:         opts.NoCompress,
-			RefreshInterval:    opts.RefreshInterval,
-			TransmitMoveNum:    opts.TransmitMoveNum,
-			KataLocalConfig:    opts.KataLocalConfig,
-			KataOverrideConfig: opts.KataOverrideConfig,
-			KataConfig:         opts.KataConfig,
-			KataWeight:         opts.KataWeight,
-			KataName:           opts.KataName,
-			UseRawData:         false,
-		}, subCommands, os.Stdin, os.Stdout, os.Stderr, nil)
+			l.Printf("Failed to create the balancer. %v", err)
+			os.Exit(client.CommandExitCode(err))
+		}
+		balancer.SetTracer(tracer)
+	}
+	err = client.RunCommand(opts.Command, &client.CommandContext{
+		Client:      remoteClient,
+		Balancer:    balancer,
+		Options:     client.NewRunKatagoOptions(&opts),
+		SubCommands: subCommands,
+		Flags:       &opts,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+	})
+	// the sessions finish the trace by themselves, this is for the other commands
+	tracer.Finish(err)
+	if err != nil {
+		l.Printf("ERROR %s failed: %v", opts.Command, err)
+		if client.ClassifyError(err) == client.ErrorClassRemote {
+			// the exit code of the process is ExitCodeRemote, the raw status of katago is logged here
+			l.Printf("ERROR katago exit status: %d signal: %s", client.ExitCodeOf(err), client.ExitSignalOf(err))
+		}
+		os.Exit(client.CommandExitCode(err))
+	}
+}
+
+func runCredentialsCommand(ctx *client.CommandContext) error {
+	if len(opts.Platform) == 0 || len(opts.Username) == 0 {
+		return client.NewUsageError("the required flags `-p, --platform' and `-u, --username' were not specified")
+	}
+	store, err := credentials.DefaultStore()
+	if err != nil {
+		return err
+	}
+	if opts.Command == "logout" {
+		err = store.Delete(opts.Platform, opts.Username)
 		if err != nil {
-			l.Printf("ERROR preload katago failed: %v", err)
-			l.Fatal("Failed to preload katago.", err)
+			return err
 		}
-		sessionResult.Wait()
-	} else if opts.Command == "query-server" {
-		// run katago command
-		err := remoteClient.QueryServer(os.Stdout)
+		fmt.Fprintf(ctx.Stderr, "Logged out %s on %s\n", opts.Username, opts.Platform)
+		return nil
+	}
+	password := opts.Password
+	if len(password) == 0 && opts.PasswordCommand != nil {
+		password, err = credentials.RunPasswordCommand(*opts.PasswordCommand)
 		if err != nil {
-			l.Fatal("Failed to query server.", err)
-		}
-	} else if opts.Command == "view-config" {
-		err := remoteClient.ViewConfig(client.RunKatagoOptions{
-			NoCompress:         opts.NoCompress,
-			RefreshInterval:    opts.RefreshInterval,
-			TransmitMoveNum:    opts.TransmitMoveNum,
-			KataLocalConfig:    opts.KataLocalConfig,
-			KataOverrideConfig: opts.KataOverrideConfig,
-			KataConfig:         opts.KataConfig,
-			KataWeight:         opts.KataWeight,
-			KataName:           opts.KataName,
-			UseRawData:         false,
-		}, subCommands, os.Stdout)
+			return err
+		}
+	}
+	if len(password) == 0 {
+		password, err = credentials.Prompt(os.Stdin, ctx.Stderr, fmt.Sprintf("Password for %s on %s: ", opts.Username, opts.Platform))
 		if err != nil {
-			l.Printf("ERROR view katago config failed: %v", err)
-			l.Fatal("Failed to view katago config.", err)
+			return err
+		}
+		if len(password) == 0 {
+			return client.NewUsageError("the password is empty")
 		}
-	} else {
-		l.Fatal(fmt.Sprintf("Unknown command: [%s]", opts.Command))
 	}
+	err = store.Set(opts.Platform, opts.Username, password)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stderr, "Logged in %s on %s\n", opts.Username, opts.Platform)
+	return nil
+}
+
+// newBalancer creates the balancer of the --balance-profiles, each profile is logged in with its own credentials
+func newBalancer() (*client.Balancer, error) {
+	names := make([]string, 0)
+	clientOptions := make([]client.Options, 0)
+	for _, name := range strings.Split(*opts.BalanceProfiles, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		profileOpts, _, err := config.ParseArgsWithProfile(os.Args[1:], name)
+		if err != nil {
+			log.Printf("ERROR cannot load profile [%s]: %v\n", name, err)
+			return nil, err
+		}
+		if profileOpts.World == nil {
+			profileOpts.World = opts.World
+		}
+		err = credentials.Resolve(profileOpts, true)
+		if err != nil {
+			log.Printf("ERROR failed to resolve the password of profile [%s]: %v\n", name, err)
+			return nil, err
+		}
+		err = client.CheckLoginOptions(profileOpts)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		clientOptions = append(clientOptions, client.Options{
+			World:      *profileOpts.World,
+			Platform:   profileOpts.Platform,
+			Username:   profileOpts.Username,
+			Password:   profileOpts.Password,
+			EngineType: profileOpts.EngineType,
+			ForceNode:  profileOpts.ForceNode,
+			GpuType:    profileOpts.GpuType,
+			Token:      profileOpts.Token,
+		})
+	}
+	balancer, err := client.NewBalancer(opts.BalanceStrategy, names, clientOptions)
+	if err != nil {
+		return nil, client.NewUsageError(fmt.Sprintf("invalid --balance-profiles: %v", err))
+	}
+	return balancer, nil
 }
@@ -0,0 +1,262 @@
+// Package metrics keeps the counters, gauges and histograms of the client, and exposes them in the
+// prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefaultBuckets are the histogram buckets in seconds, from 5ms to 60s
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	registryLock sync.Mutex
+	registry     = make([]*family, 0)
+)
+
+// family is a metric with all of its label values
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// CounterVec is a counter with labels
+type CounterVec struct {
+	family *family
+}
+
+// GaugeVec is a gauge with labels
+type GaugeVec struct {
+	family *family
+}
+
+// HistogramVec is a histogram with labels
+type HistogramVec struct {
+	family *family
+}
+
+func newFamily(name string, help string, kind string, labelNames []string, buckets []float64) *family {
+	f := &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, f)
+	return f
+}
+
+// NewCounterVec registers the counter
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{family: newFamily(name, help, typeCounter, labelNames, nil)}
+}
+
+// NewGaugeVec registers the gauge
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{family: newFamily(name, help, typeGauge, labelNames, nil)}
+}
+
+// NewHistogramVec registers the histogram, DefaultBuckets are used if buckets is nil
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &HistogramVec{family: newFamily(name, help, typeHistogram, labelNames, buckets)}
+}
+
+// update runs fn on the series of the label values with the lock held
+func (f *family) update(labelValues []string, fn func(s *series)) {
+	if len(labelValues) != len(f.labelNames) {
+		log.Printf("ERROR wrong number of labels for metric %s: %v\n", f.name, labelValues)
+		return
+	}
+	key := strings.Join(labelValues, "\x00")
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// Add adds the value to the counter, the value must not be negative
+func (v *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	v.family.update(labelValues, func(s *series) {
+		s.value += value
+	})
+}
+
+// Inc adds one to the counter
+func (v *CounterVec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Add adds the value to the gauge, the value can be negative
+func (v *GaugeVec) Add(value float64, labelValues ...string) {
+	v.family.update(labelValues, func(s *series) {
+		s.value += value
+	})
+}
+
+// Inc adds one to the gauge
+func (v *GaugeVec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Dec subtracts one from the gauge
+func (v *GaugeVec) Dec(labelValues ...string) {
+	v.Add(-1, labelValues...)
+}
+
+// Set sets the gauge
+func (v *GaugeVec) Set(value float64, labelValues ...string) {
+	v.family.update(labelValues, func(s *series) {
+		s.value = value
+	})
+}
+
+// Observe records a value in the histogram
+func (v *HistogramVec) Observe(value float64, labelValues ...string) {
+	v.family.update(labelValues, func(s *series) {
+		for i, bound := range v.family.buckets {
+			if value <= bound {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.sum += value
+	})
+}
+
+// WriteTo writes all the metrics in the prometheus text format
+func WriteTo(w io.Writer) error {
+	registryLock.Lock()
+	families := append([]*family{}, registry...)
+	registryLock.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+	for _, f := range families {
+		err := f.write(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *family) write(w io.Writer) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(builder, "# TYPE %s %s\n", f.name, f.kind)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != typeHistogram {
+			fmt.Fprintf(builder, "%s%s %s\n", f.name, f.labels(s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(builder, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, "le", formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(builder, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(builder, "%s_sum%s %s\n", f.name, f.labels(s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(builder, "%s_count%s %d\n", f.name, f.labels(s.labelValues, "", ""), s.count)
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// labels formats the labels, with the extra label of the histogram buckets
+func (f *family) labels(labelValues []string, extraName string, extraValue string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, name := range f.labelNames {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(labelValues[i])))
+	}
+	if len(extraName) > 0 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"").Replace(s)
+}
+
+// Handler returns the http handler of the metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// ListenAndServe serves the metrics at /metrics on the address, like :9100. it blocks until the server fails.
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("DEBUG serving the metrics at http://%s/metrics\n", listener.Addr())
+	return http.Serve(listener, mux)
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "The number of requests.\nBy path.", "path", "code")
+	gauge := NewGaugeVec("test_active", "The active sessions.")
+	histogram := NewHistogramVec("test_duration_seconds", "The duration.", []float64{0.1, 1}, "command")
+
+	counter.Inc("/b", "200")
+	counter.Add(2.5, `/a"\`+"\n", "500")
+	counter.Add(-1, "/b", "200")
+	counter.Inc("/b")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	for _, value := range []float64{0.25, 0.5, 2, 0.0625} {
+		histogram.Observe(value, "genmove")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_active The active sessions.
+# TYPE test_active gauge
+test_active 1
+# HELP test_duration_seconds The duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{command="genmove",le="0.1"} 1
+test_duration_seconds_bucket{command="genmove",le="1"} 3
+test_duration_seconds_bucket{command="genmove",le="+Inf"} 4
+test_duration_seconds_sum{command="genmove"} 2.8125
+test_duration_seconds_count{command="genmove"} 4
+# HELP test_requests_total The number of requests.\nBy path.
+# TYPE test_requests_total counter
+test_requests_total{path="/a\"\\\n",code="500"} 2.5
+test_requests_total{path="/b",code="200"} 1
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -9,24 +9,43 @@ type SSHOptions struct {
 	Password string `json:"password"`
 }
 type AllOpts struct {
-	World              *string `short:"w" long:"world" description:"The world url."`
-	Platform           string  `short:"p" long:"platform" description:"The platform, like aistudio, colab" required:"true"`
-	Username           string  `short:"u" long:"username" description:"Your username to connect" required:"true"`
-	Password           string  `long:"password" description:"Your password to connect" required:"true"`
-	NoCompress         bool    `long:"no-compress" description:"compress the data during transmission"`
-	RefreshInterval    int     `long:"refresh-interval" description:"sets the refresh interval in cent seconds" default:"30"`
-	EngineType         *string `long:"engine-type" description:"sets the enginetype"`
-	Token              *string `long:"token" description:"sets the token"`
-	GpuType            *string `long:"gpu-type" description:"sets the gpu type"`
-	TransmitMoveNum    int     `long:"transmit-move-num" description:"limits number of moves when transmission during analyze" default:"20"`
-	KataLocalConfig    *string `long:"kata-local-config" description:"The katago config file. like, gtp_example.cfg"`
-	KataOverrideConfig *string `long:"kata-override-config" description:"The katago override-config, like: analysisPVLen=30,numSearchThreads=30"`
+	World              *string `short:"w" long:"world" env:"IKATAGO_WORLD" description:"The world url."`
+	Platform           string  `short:"p" long:"platform" env:"IKATAGO_PLATFORM" description:"The platform, like aistudio, colab"`
+	Username           string  `short:"u" long:"username" env:"IKATAGO_USERNAME" description:"Your username to connect"`
+	Password           string  `long:"password" env:"IKATAGO_PASSWORD" description:"Your password to connect, prefer --password-command or the login command"`
+	PasswordCommand    *string `long:"password-command" env:"IKATAGO_PASSWORD_COMMAND" description:"The command which prints your password to stdout"`
+	NoCompress         bool    `long:"no-compress" env:"IKATAGO_NO_COMPRESS" description:"compress the data during transmission"`
+	RefreshInterval    int     `long:"refresh-interval" env:"IKATAGO_REFRESH_INTERVAL" description:"sets the refresh interval in cent seconds" default:"30"`
+	EngineType         *string `long:"engine-type" env:"IKATAGO_ENGINE_TYPE" description:"sets the enginetype"`
+	Token              *string `long:"token" env:"IKATAGO_TOKEN" description:"sets the token"`
+	GpuType            *string `long:"gpu-type" env:"IKATAGO_GPU_TYPE" description:"sets the gpu type"`
+	TransmitMoveNum    int     `long:"transmit-move-num" env:"IKATAGO_TRANSMIT_MOVE_NUM" description:"limits number of moves when transmission during analyze" default:"20"`
+	KataLocalConfig    *string `long:"kata-local-config" env:"IKATAGO_KATA_LOCAL_CONFIG" description:"The katago config file. like, gtp_example.cfg"`
+	KataOverrideConfig *string `long:"kata-override-config" env:"IKATAGO_KATA_OVERRIDE_CONFIG" description:"The katago override-config, like: analysisPVLen=30,numSearchThreads=30"`
 
-	KataName   *string `long:"kata-name" description:"The katago binary name"`
-	ForceNode  *string `long:"force-node" description:"in cluster, force to a specific node."`
-	KataWeight *string `long:"kata-weight" description:"The katago weight name"`
-	KataConfig *string `long:"kata-config" description:"The katago config name"`
-	ExtraInfo  *string `long:"extra-info" description:"The extra info"`
-	ClientID   *string `long:"client-id" description:"The source client id"`
-	Command    string  `long:"cmd" description:"The command to run the katago" default:"run-katago"`
+	KataName        *string `long:"kata-name" env:"IKATAGO_KATA_NAME" description:"The katago binary name"`
+	ForceNode       *string `long:"force-node" env:"IKATAGO_FORCE_NODE" description:"in cluster, force to a specific node."`
+	KataWeight      *string `long:"kata-weight" env:"IKATAGO_KATA_WEIGHT" description:"The katago weight name"`
+	KataConfig      *string `long:"kata-config" env:"IKATAGO_KATA_CONFIG" description:"The katago config name"`
+	ExtraInfo       *string `long:"extra-info" env:"IKATAGO_EXTRA_INFO" description:"The extra info"`
+	ClientID        *string `long:"client-id" env:"IKATAGO_CLIENT_ID" description:"The source client id"`
+	Command         string  `long:"cmd" env:"IKATAGO_CMD" description:"The command to run, like run-katago, query-server. run --cmd help for all the commands" default:"run-katago"`
+	Config          *string `long:"config" env:"IKATAGO_CONFIG" description:"The config file with the profiles, default: ~/.ikatago/config.yaml"`
+	Profile         *string `long:"profile" env:"IKATAGO_PROFILE" description:"The profile in the config file to use"`
+	Record          *string `long:"record" env:"IKATAGO_RECORD" description:"Records the gtp commands and the katago output into the file"`
+	ReplayFile      *string `long:"replay-file" env:"IKATAGO_REPLAY_FILE" description:"The record file to replay with the replay command"`
+	FallbackKatago  *string `long:"fallback-katago" env:"IKATAGO_FALLBACK_KATAGO" description:"The local katago binary to use if the remote katago fails"`
+	FallbackModel   *string `long:"fallback-model" env:"IKATAGO_FALLBACK_MODEL" description:"The model file of the local katago"`
+	FallbackConfig  *string `long:"fallback-config" env:"IKATAGO_FALLBACK_CONFIG" description:"The config file of the local katago, default: --kata-local-config"`
+	PingCount       int     `long:"ping-count" env:"IKATAGO_PING_COUNT" description:"The number of round trips of the ping command" default:"10"`
+	PingSettings    *string `long:"ping-settings" env:"IKATAGO_PING_SETTINGS" description:"The refresh-interval:transmit-move-num pairs to test the throughput with, like: 30:20,50:10"`
+	SaveProfile     *string `long:"save-profile" env:"IKATAGO_SAVE_PROFILE" description:"The profile to save the recommended numSearchThreads of the benchmark command into"`
+	SaveConfig      *string `long:"save-config" env:"IKATAGO_SAVE_CONFIG" description:"The local katago config file to save the recommended numSearchThreads of the benchmark command into"`
+	MetricsListen   *string `long:"metrics-listen" env:"IKATAGO_METRICS_LISTEN" description:"Serves the prometheus metrics at /metrics on the address, like: 127.0.0.1:9100"`
+	Attach          *string `long:"attach" env:"IKATAGO_ATTACH" description:"Attaches run-katago to the preloaded katago, the id printed by preload-katago, or latest"`
+	TraceFile       *string `long:"trace-file" env:"IKATAGO_TRACE_FILE" description:"Writes the trace of the startup phases into the file in the OTLP json format"`
+	TraceOTLP       *string `long:"trace-otlp" env:"IKATAGO_TRACE_OTLP" description:"Exports the trace of the startup phases to the OTLP http collector, like: http://127.0.0.1:4318"`
+	BalanceProfiles *string `long:"balance-profiles" env:"IKATAGO_BALANCE_PROFILES" description:"The profiles to balance the run-katago sessions across, like: aistudio,colab"`
+	BalanceStrategy string  `long:"balance-strategy" env:"IKATAGO_BALANCE_STRATEGY" description:"The strategy to choose the profile" choice:"fastest" choice:"least-loaded" default:"fastest"`
+	Output          string  `long:"output" env:"IKATAGO_OUTPUT" description:"The output format of the informational commands" choice:"table" choice:"json" default:"table"`
 }
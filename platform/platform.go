@@ -1,5 +1,14 @@
 package platform
 
+const (
+	// DiscoveryHTTP means the ssh info is discovered via the platform's http endpoints
+	DiscoveryHTTP = "http"
+	// DiscoveryOSS means the ssh info is discovered via the platform's oss bucket
+	DiscoveryOSS = "oss"
+	// DiscoveryHTTPPost means the ssh info is discovered only via the platform's getPostUrl
+	DiscoveryHTTPPost = "http-post"
+)
+
 // Oss represents the oss bucket of this platform
 type Oss struct {
 	BucketEndpoint string `json:"bucketEndpoint"`
@@ -17,3 +26,51 @@ type Platform struct {
 	Oss  Oss    `json:"oss"`
 	Http *Http  `json:"http"`
 }
+
+// World represents the world, which contains all the platforms
+type World struct {
+	Platforms []Platform `json:"platforms"`
+}
+
+// DiscoveryType returns how the ssh info of the users are discovered on this platform
+func (p *Platform) DiscoveryType() string {
+	if p.Http != nil && p.Http.GetUrl != nil {
+		return DiscoveryHTTP
+	}
+	if p.Http != nil && p.Http.GetPostUrl != nil && len(*p.Http.GetPostUrl) > 0 {
+		return DiscoveryHTTPPost
+	}
+	return DiscoveryOSS
+}
+
+// BaseURL returns the base url where the users' ssh info are located, it is empty if the platform has no public ssh info
+func (p *Platform) BaseURL() string {
+	if p.DiscoveryType() == DiscoveryHTTP {
+		return *p.Http.GetUrl
+	}
+	if p.DiscoveryType() == DiscoveryHTTPPost {
+		return ""
+	}
+	if len(p.Oss.Bucket) == 0 || len(p.Oss.BucketEndpoint) == 0 {
+		return ""
+	}
+	return "https://" + p.Oss.Bucket + "." + p.Oss.BucketEndpoint
+}
+
+// SSHJSONURL returns the public url of the user's ssh info, it is empty if the platform has no public ssh info
+func (p *Platform) SSHJSONURL(username string) string {
+	if len(p.BaseURL()) == 0 {
+		return ""
+	}
+	return p.BaseURL() + "/users/" + username + ".ssh.json"
+}
+
+// FindPlatform finds the platform by name
+func (w *World) FindPlatform(name string) *Platform {
+	for i := range w.Platforms {
+		if w.Platforms[i].Name == name {
+			return &w.Platforms[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+// Package tracing records the spans of the startup phases, and exports them in the OTLP json format,
+// to an OTLP http collector or to a file.
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	statusOK    = 1
+	statusError = 2
+	// spanKindInternal is the OTLP span kind of all the spans
+	spanKindInternal = 1
+)
+
+// Span represents a timed phase, the methods are safe to be called on nil
+type Span struct {
+	tracer     *Tracer
+	id         string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+	ended      bool
+}
+
+// Tracer records the spans of a trace, all the spans are children of the root span.
+// the methods are safe to be called on nil, so that the tracing is optional.
+type Tracer struct {
+	serviceName string
+	traceID     string
+	root        *Span
+
+	lock      sync.Mutex
+	spans     []*Span
+	exporters []func(payload []byte) error
+	finished  bool
+}
+
+// NewTracer creates the tracer, and starts the root span
+func NewTracer(serviceName string, rootName string) *Tracer {
+	tracer := &Tracer{
+		serviceName: serviceName,
+		traceID:     randomID(16),
+		spans:       make([]*Span, 0),
+	}
+	tracer.root = tracer.newSpan(rootName, "")
+	return tracer
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (tracer *Tracer) newSpan(name string, parentID string) *Span {
+	span := &Span{
+		tracer:     tracer,
+		id:         randomID(8),
+		parentID:   parentID,
+		name:       name,
+		start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	tracer.spans = append(tracer.spans, span)
+	return span
+}
+
+// StartSpan starts a child span of the root span
+func (tracer *Tracer) StartSpan(name string) *Span {
+	if tracer == nil {
+		return nil
+	}
+	return tracer.newSpan(name, tracer.root.id)
+}
+
+// Root returns the root span
+func (tracer *Tracer) Root() *Span {
+	if tracer == nil {
+		return nil
+	}
+	return tracer.root
+}
+
+// ExportToFile writes the trace into the file when the tracer is finished
+func (tracer *Tracer) ExportToFile(path string) {
+	tracer.addExporter(func(payload []byte) error {
+		return ioutil.WriteFile(path, payload, 0644)
+	})
+}
+
+// ExportToOTLP posts the trace to the OTLP http collector when the tracer is finished, like: http://127.0.0.1:4318
+func (tracer *Tracer) ExportToOTLP(endpoint string) {
+	url := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url = url + "/v1/traces"
+	}
+	tracer.addExporter(func(payload []byte) error {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Printf("ERROR the OTLP collector responded with status code: %d\n", resp.StatusCode)
+			return errors.New("invalid_status")
+		}
+		return nil
+	})
+}
+
+func (tracer *Tracer) addExporter(exporter func(payload []byte) error) {
+	if tracer == nil {
+		return
+	}
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	tracer.exporters = append(tracer.exporters, exporter)
+}
+
+// End ends the root span and the unfinished spans without exporting the trace, the trace is exported by Finish.
+// it does not block, so it can be called when the startup ends in the middle of the session.
+func (tracer *Tracer) End(err error) {
+	if tracer == nil {
+		return
+	}
+	tracer.lock.Lock()
+	spans := append([]*Span{}, tracer.spans...)
+	tracer.lock.Unlock()
+	tracer.root.End(err)
+	for _, span := range spans {
+		span.End(nil)
+	}
+}
+
+// Finish ends the root span and the unfinished spans unless End has been called, and exports the trace.
+// only the first call takes effect.
+func (tracer *Tracer) Finish(err error) {
+	if tracer == nil {
+		return
+	}
+	tracer.lock.Lock()
+	if tracer.finished {
+		tracer.lock.Unlock()
+		return
+	}
+	tracer.finished = true
+	exporters := tracer.exporters
+	tracer.lock.Unlock()
+
+	tracer.End(err)
+	tracer.lock.Lock()
+	spans := append([]*Span{}, tracer.spans...)
+	tracer.lock.Unlock()
+	payload, marshalErr := json.Marshal(tracer.otlp(spans))
+	if marshalErr != nil {
+		log.Printf("ERROR failed to encode the trace: %v\n", marshalErr)
+		return
+	}
+	for _, exporter := range exporters {
+		if exportErr := exporter(payload); exportErr != nil {
+			log.Printf("ERROR failed to export the trace: %v\n", exportErr)
+		}
+	}
+}
+
+// SetAttribute sets the attribute of the span
+func (span *Span) SetAttribute(key string, value interface{}) {
+	if span == nil {
+		return
+	}
+	span.tracer.lock.Lock()
+	defer span.tracer.lock.Unlock()
+	span.attributes[key] = fmt.Sprint(value)
+}
+
+// End ends the span with the error of the phase, only the first call takes effect
+func (span *Span) End(err error) {
+	if span == nil {
+		return
+	}
+	span.tracer.lock.Lock()
+	defer span.tracer.lock.Unlock()
+	if span.ended {
+		return
+	}
+	span.ended = true
+	span.end = time.Now()
+	span.err = err
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTrace struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlp converts the spans into the OTLP json format
+func (tracer *Tracer) otlp(spans []*Span) *otlpTrace {
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(spans))}
+	scope.Scope.Name = "ikatago"
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           tracer.traceID,
+			SpanID:            span.id,
+			ParentSpanID:      span.parentID,
+			Name:              span.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: statusOK},
+		}
+		keys := make([]string, 0, len(span.attributes))
+		for key := range span.attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: span.attributes[key]}})
+		}
+		if span.err != nil {
+			s.Status = otlpStatus{Code: statusError, Message: span.err.Error()}
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: tracer.serviceName}}}
+	return &otlpTrace{ResourceSpans: []otlpResourceSpans{resource}}
+}
@@ -8,12 +8,21 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"moul.io/http2curl/v2"
 )
 
 // DoHTTPRequest Sends generic http request
 func DoHTTPRequest(method string, url string, headers map[string]string, body []byte) (responseBody string, err error) {
+	_, responseBody, err = DoHTTPRequestWithStatus(method, url, headers, body)
+	return
+}
+
+// DoHTTPRequestWithStatus sends generic http request like DoHTTPRequest, and returns the status code too.
+// the status code is 0 if the request cannot be sent.
+func DoHTTPRequestWithStatus(method string, url string, headers map[string]string, body []byte) (statusCode int, responseBody string, err error) {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
@@ -34,6 +43,7 @@ func DoHTTPRequest(method string, url string, headers map[string]string, body []
 		err = errors.New("failed_do_request")
 		return
 	}
+	statusCode = response.StatusCode
 	bodyBytes, err := ioutil.ReadAll(response.Body)
 	response.Body.Close()
 
@@ -71,3 +81,63 @@ func GetFileSize(filename string) (int64, error) {
 	}
 	return info.Size(), nil
 }
+
+// WriteFileAtomic writes the file by renaming a temp file in the same directory, so that the readers never see
+// a partially written file
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tempName := f.Name()
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempName, perm)
+	}
+	if err == nil {
+		err = os.Rename(tempName, filename)
+	}
+	if err != nil {
+		os.Remove(tempName)
+	}
+	return err
+}
+
+const (
+	// lockRetryInterval is the interval of trying to take the lock held by another process
+	lockRetryInterval = 10 * time.Millisecond
+	// lockTimeout is how long LockFile waits for the lock
+	lockTimeout = 5 * time.Second
+	// staleLockAge is the age of a lock file left by a killed process, it is removed then
+	staleLockAge = 10 * time.Second
+)
+
+// LockFile takes the lock of the file across the processes, by creating filename.lock exclusively.
+// the returned function releases the lock.
+func LockFile(filename string) (func(), error) {
+	lockName := filename + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockName) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockName); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			log.Printf("WARNING removing the stale lock: %s\n", lockName)
+			os.Remove(lockName)
+			continue
+		}
+		if time.Now().After(deadline) {
+			log.Printf("ERROR timeout waiting for the lock: %s\n", lockName)
+			return nil, errors.New("lock_timeout")
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}